@@ -1,26 +1,13 @@
 package main
 
-/*
-func main() {
-	var expr Expression = BinaryExpression{
-		Left: UnaryExpression{
-			Operator: Token{TT_MINUS, "-", nil, 1},
-			Right:    LiteralExpression{Value: 123},
-		},
-		Operator: Token{
-			TokenType: TT_STAR,
-			Lexeme:    "*",
-			Literal:   nil,
-			Line:      1,
-		},
-		Right: GroupingExpression{Expression: &LiteralExpression{Value: 54.56}},
-	}
-	var printer = AstPrinter{}
-	fmt.Println(printer.Print(expr))
-}
-*/
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
 
-/*
+// AstPrinter renders the AST as Lisp-style S-expressions, one line per
+// top-level statement.
 type AstPrinter struct {
 }
 
@@ -28,6 +15,15 @@ func (a *AstPrinter) Print(expr Expression) string {
 	return a.stringify(expr.Accept(a))
 }
 
+func (a *AstPrinter) PrintProgram(statements []Statement) string {
+	var sb strings.Builder
+	for _, stmt := range statements {
+		sb.WriteString(a.stringify(stmt.Accept(a)))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
 func (a *AstPrinter) visitBinaryExpr(expr BinaryExpression) Any {
 	return a.parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right)
 }
@@ -37,23 +33,195 @@ func (a *AstPrinter) visitGroupingExpr(expr GroupingExpression) Any {
 }
 
 func (a *AstPrinter) visitLiteralExpr(expr LiteralExpression) Any {
-	if expr.Value == nil {
-		return "nil"
-	}
-	return fmt.Sprintf("%s", expr.Value)
+	return literalString(expr.Value)
 }
 
 func (a *AstPrinter) visitUnaryExpr(expr UnaryExpression) Any {
 	return a.parenthesize(expr.Operator.Lexeme, expr.Right)
 }
 
+func (a *AstPrinter) visitVarExpr(expr *VariableExpression) Any {
+	return expr.Name.Lexeme
+}
+
+func (a *AstPrinter) visitAssignExpr(expr *AssignExpression) Any {
+	return a.parenthesize("= "+expr.Name.Lexeme, expr.Value)
+}
+
+func (a *AstPrinter) visitCallExpr(expr CallExpression) Any {
+	return a.parenthesize("call", append([]Expression{expr.Callee}, expr.Arguments...)...)
+}
+
+func (a *AstPrinter) visitListExpr(expr ListExpression) Any {
+	return a.parenthesize("list", expr.Elements...)
+}
+
+func (a *AstPrinter) visitMapExpr(expr MapExpression) Any {
+	var entries []string
+	for n := range expr.Keys {
+		entries = append(entries, a.parenthesize(a.Print(expr.Keys[n]), expr.Values[n]))
+	}
+	return a.form("map", entries...)
+}
+
+func (a *AstPrinter) visitRangeExpr(expr RangeExpression) Any {
+	return a.parenthesize(expr.Operator.Lexeme, expr.Start, expr.End)
+}
+
+func (a *AstPrinter) visitErrorExpr(expr ErrorExpression) Any {
+	return "(error)"
+}
+
+func (a *AstPrinter) visitPrintStmt(stmt PrintStatement) Any {
+	return a.parenthesize("print", stmt.Expression)
+}
+
+func (a *AstPrinter) visitExprStmt(stmt ExpressionStatement) Any {
+	return a.parenthesize("expr", stmt.Expression)
+}
+
+func (a *AstPrinter) visitVarStmt(stmt VarStatement) Any {
+	if stmt.Initializer == nil {
+		return a.form("var " + stmt.Name.Lexeme)
+	}
+	return a.parenthesize("var "+stmt.Name.Lexeme, stmt.Initializer)
+}
+
+func (a *AstPrinter) visitBlockStmt(stmt BlockStatement) Any {
+	return a.form("block", a.statements(stmt.Statements)...)
+}
+
+func (a *AstPrinter) visitIfStmt(stmt IfStatement) Any {
+	parts := []string{a.Print(stmt.Condition), a.statement(stmt.ThenBlock)}
+	if stmt.ElseBlock != nil {
+		parts = append(parts, a.statement(stmt.ElseBlock))
+	}
+	return a.form("if", parts...)
+}
+
+func (a *AstPrinter) visitWhileStmt(stmt WhileStatement) Any {
+	return a.form("while", a.Print(stmt.Condition), a.statement(stmt.Body))
+}
+
+func (a *AstPrinter) visitForInStmt(stmt ForInStatement) Any {
+	variables := "(" + strings.Join(a.lexemes(stmt.Variables), " ") + ")"
+	return a.form("for", variables, a.Print(stmt.Iterable), a.statement(stmt.Body))
+}
+
+func (a *AstPrinter) visitFunctionStmt(stmt FunctionStatement) Any {
+	keyword := "fun"
+	if stmt.Generator {
+		keyword = "generator"
+	}
+	parts := []string{stmt.Name.Lexeme, "(" + strings.Join(a.lexemes(stmt.Params), " ") + ")"}
+	return a.form(keyword, append(parts, a.statements(stmt.Body)...)...)
+}
+
+func (a *AstPrinter) visitReturnStmt(stmt ReturnStatement) Any {
+	if stmt.Value == nil {
+		return "(return)"
+	}
+	return a.parenthesize("return", stmt.Value)
+}
+
+func (a *AstPrinter) visitYieldStmt(stmt YieldStatement) Any {
+	if stmt.Value == nil {
+		return "(yield)"
+	}
+	return a.parenthesize("yield", stmt.Value)
+}
+
+func (a *AstPrinter) visitMatchStmt(stmt MatchStatement) Any {
+	parts := []string{a.Print(stmt.Subject)}
+	for _, arm := range stmt.Arms {
+		var patterns []string
+		for _, pattern := range arm.Patterns {
+			patterns = append(patterns, a.pattern(pattern))
+		}
+		armParts := []string{"(" + strings.Join(patterns, " ") + ")"}
+		if arm.Guard != nil {
+			armParts = append(armParts, a.parenthesize("if", arm.Guard))
+		}
+		parts = append(parts, a.form("arm", append(armParts, a.statement(arm.Body))...))
+	}
+	return a.form("match", parts...)
+}
+
+func (a *AstPrinter) visitErrorStmt(stmt ErrorStatement) Any {
+	return "(error)"
+}
+
+func (a *AstPrinter) visitWildcardPattern(pattern WildcardPattern) Any {
+	return "_"
+}
+
+func (a *AstPrinter) visitLiteralPattern(pattern LiteralPattern) Any {
+	return literalString(pattern.Value)
+}
+
+func (a *AstPrinter) visitBindingPattern(pattern BindingPattern) Any {
+	return pattern.Name.Lexeme
+}
+
+func (a *AstPrinter) visitTypePattern(pattern TypePattern) Any {
+	return a.form(":", pattern.Name.Lexeme, pattern.TypeName.Lexeme)
+}
+
+func (a *AstPrinter) visitListPattern(pattern ListPattern) Any {
+	var elements []string
+	for _, element := range pattern.Elements {
+		elements = append(elements, a.pattern(element))
+	}
+	return a.form("list", elements...)
+}
+
+func (a *AstPrinter) visitMapPattern(pattern MapPattern) Any {
+	var entries []string
+	for n, key := range pattern.Keys {
+		entries = append(entries, a.form(literalString(key), a.pattern(pattern.Values[n])))
+	}
+	return a.form("map", entries...)
+}
+
+func (a *AstPrinter) statement(stmt Statement) string {
+	return a.stringify(stmt.Accept(a))
+}
+
+func (a *AstPrinter) statements(stmts []Statement) []string {
+	var parts []string
+	for _, stmt := range stmts {
+		parts = append(parts, a.statement(stmt))
+	}
+	return parts
+}
+
+func (a *AstPrinter) pattern(pattern Pattern) string {
+	return a.stringify(pattern.Accept(a))
+}
+
+func (a *AstPrinter) lexemes(tokens []Token) []string {
+	var names []string
+	for _, token := range tokens {
+		names = append(names, token.Lexeme)
+	}
+	return names
+}
+
 func (a *AstPrinter) parenthesize(name string, exprs ...Expression) string {
+	var parts []string
+	for _, e := range exprs {
+		parts = append(parts, a.Print(e))
+	}
+	return a.form(name, parts...)
+}
+
+func (a *AstPrinter) form(name string, parts ...string) string {
 	var sb strings.Builder
 	sb.WriteString("(")
 	sb.WriteString(name)
-	for _, e := range exprs {
+	for _, part := range parts {
 		sb.WriteString(" ")
-		sb.WriteString(a.stringify(e.Accept(a)))
+		sb.WriteString(part)
 	}
 	sb.WriteString(")")
 	return sb.String()
@@ -62,4 +230,265 @@ func (a *AstPrinter) parenthesize(name string, exprs ...Expression) string {
 func (a *AstPrinter) stringify(object Any) string {
 	return fmt.Sprintf("%s", object)
 }
+
+/*
+	JSON
+
+	In the JSON form of the AST every node is an object with a "kind", named
+	after its Go type, and a "span" locating it in the source:
+
+	  {"kind": "BinaryExpression", "span": {"start": 6, "end": 11, "line": 1, "column": 7},
+	   "left": {...}, "operator": "+", "right": {...}}
+
+	Tokens appear as their lexeme, literal values as JSON values, and optional
+	children that are absent as null. The program itself is a node of kind
+	"Program" with a "statements" list.
 */
+
+// AstJSONPrinter renders the AST as JSON.
+type AstJSONPrinter struct {
+}
+
+type jsonNode map[string]Any
+
+func (a *AstJSONPrinter) Print(statements []Statement) (string, error) {
+	program := jsonNode{"kind": "Program", "statements": a.statements(statements)}
+	if len(statements) > 0 {
+		program["span"] = a.span(statements[0].Span().To(statements[len(statements)-1].Span()))
+	}
+	bytes, err := json.MarshalIndent(program, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(bytes) + "\n", nil
+}
+
+func (a *AstJSONPrinter) node(kind string, span Span, fields jsonNode) jsonNode {
+	fields["kind"] = kind
+	fields["span"] = a.span(span)
+	return fields
+}
+
+func (a *AstJSONPrinter) span(span Span) jsonNode {
+	return jsonNode{"start": span.Start, "end": span.End, "line": span.Line, "column": span.Column}
+}
+
+func (a *AstJSONPrinter) expression(expr Expression) Any {
+	if expr == nil {
+		return nil
+	}
+	return expr.Accept(a)
+}
+
+func (a *AstJSONPrinter) expressions(exprs []Expression) []Any {
+	nodes := make([]Any, 0, len(exprs))
+	for _, expr := range exprs {
+		nodes = append(nodes, a.expression(expr))
+	}
+	return nodes
+}
+
+func (a *AstJSONPrinter) statement(stmt Statement) Any {
+	if stmt == nil {
+		return nil
+	}
+	return stmt.Accept(a)
+}
+
+func (a *AstJSONPrinter) statements(stmts []Statement) []Any {
+	nodes := make([]Any, 0, len(stmts))
+	for _, stmt := range stmts {
+		nodes = append(nodes, a.statement(stmt))
+	}
+	return nodes
+}
+
+func (a *AstJSONPrinter) patterns(patterns []Pattern) []Any {
+	nodes := make([]Any, 0, len(patterns))
+	for _, pattern := range patterns {
+		nodes = append(nodes, pattern.Accept(a))
+	}
+	return nodes
+}
+
+func (a *AstJSONPrinter) lexemes(tokens []Token) []string {
+	names := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		names = append(names, token.Lexeme)
+	}
+	return names
+}
+
+func (a *AstJSONPrinter) visitBinaryExpr(expr BinaryExpression) Any {
+	return a.node("BinaryExpression", expr.Span(), jsonNode{
+		"left":     a.expression(expr.Left),
+		"operator": expr.Operator.Lexeme,
+		"right":    a.expression(expr.Right),
+	})
+}
+
+func (a *AstJSONPrinter) visitGroupingExpr(expr GroupingExpression) Any {
+	return a.node("GroupingExpression", expr.Span(), jsonNode{"expression": a.expression(expr.Expression)})
+}
+
+func (a *AstJSONPrinter) visitLiteralExpr(expr LiteralExpression) Any {
+	return a.node("LiteralExpression", expr.Span(), jsonNode{"value": expr.Value})
+}
+
+func (a *AstJSONPrinter) visitUnaryExpr(expr UnaryExpression) Any {
+	return a.node("UnaryExpression", expr.Span(), jsonNode{
+		"operator": expr.Operator.Lexeme,
+		"right":    a.expression(expr.Right),
+	})
+}
+
+func (a *AstJSONPrinter) visitVarExpr(expr *VariableExpression) Any {
+	return a.node("VariableExpression", expr.Span(), jsonNode{"name": expr.Name.Lexeme})
+}
+
+func (a *AstJSONPrinter) visitAssignExpr(expr *AssignExpression) Any {
+	return a.node("AssignExpression", expr.Span(), jsonNode{
+		"name":  expr.Name.Lexeme,
+		"value": a.expression(expr.Value),
+	})
+}
+
+func (a *AstJSONPrinter) visitCallExpr(expr CallExpression) Any {
+	return a.node("CallExpression", expr.Span(), jsonNode{
+		"callee":    a.expression(expr.Callee),
+		"arguments": a.expressions(expr.Arguments),
+	})
+}
+
+func (a *AstJSONPrinter) visitListExpr(expr ListExpression) Any {
+	return a.node("ListExpression", expr.Span(), jsonNode{"elements": a.expressions(expr.Elements)})
+}
+
+func (a *AstJSONPrinter) visitMapExpr(expr MapExpression) Any {
+	return a.node("MapExpression", expr.Span(), jsonNode{
+		"keys":   a.expressions(expr.Keys),
+		"values": a.expressions(expr.Values),
+	})
+}
+
+func (a *AstJSONPrinter) visitRangeExpr(expr RangeExpression) Any {
+	return a.node("RangeExpression", expr.Span(), jsonNode{
+		"start":     a.expression(expr.Start),
+		"end":       a.expression(expr.End),
+		"inclusive": expr.Operator.TokenType == TT_DOT_DOT,
+	})
+}
+
+func (a *AstJSONPrinter) visitErrorExpr(expr ErrorExpression) Any {
+	return a.node("ErrorExpression", expr.Span(), jsonNode{})
+}
+
+func (a *AstJSONPrinter) visitPrintStmt(stmt PrintStatement) Any {
+	return a.node("PrintStatement", stmt.Span(), jsonNode{"expression": a.expression(stmt.Expression)})
+}
+
+func (a *AstJSONPrinter) visitExprStmt(stmt ExpressionStatement) Any {
+	return a.node("ExpressionStatement", stmt.Span(), jsonNode{"expression": a.expression(stmt.Expression)})
+}
+
+func (a *AstJSONPrinter) visitVarStmt(stmt VarStatement) Any {
+	return a.node("VarStatement", stmt.Span(), jsonNode{
+		"name":        stmt.Name.Lexeme,
+		"initializer": a.expression(stmt.Initializer),
+		"doc":         stmt.Doc,
+	})
+}
+
+func (a *AstJSONPrinter) visitBlockStmt(stmt BlockStatement) Any {
+	return a.node("BlockStatement", stmt.Span(), jsonNode{"statements": a.statements(stmt.Statements)})
+}
+
+func (a *AstJSONPrinter) visitIfStmt(stmt IfStatement) Any {
+	return a.node("IfStatement", stmt.Span(), jsonNode{
+		"condition": a.expression(stmt.Condition),
+		"then":      a.statement(stmt.ThenBlock),
+		"else":      a.statement(stmt.ElseBlock),
+	})
+}
+
+func (a *AstJSONPrinter) visitWhileStmt(stmt WhileStatement) Any {
+	return a.node("WhileStatement", stmt.Span(), jsonNode{
+		"condition": a.expression(stmt.Condition),
+		"body":      a.statement(stmt.Body),
+	})
+}
+
+func (a *AstJSONPrinter) visitForInStmt(stmt ForInStatement) Any {
+	return a.node("ForInStatement", stmt.Span(), jsonNode{
+		"variables": a.lexemes(stmt.Variables),
+		"iterable":  a.expression(stmt.Iterable),
+		"body":      a.statement(stmt.Body),
+	})
+}
+
+func (a *AstJSONPrinter) visitFunctionStmt(stmt FunctionStatement) Any {
+	return a.node("FunctionStatement", stmt.Span(), jsonNode{
+		"name":      stmt.Name.Lexeme,
+		"params":    a.lexemes(stmt.Params),
+		"body":      a.statements(stmt.Body),
+		"generator": stmt.Generator,
+		"doc":       stmt.Doc,
+	})
+}
+
+func (a *AstJSONPrinter) visitReturnStmt(stmt ReturnStatement) Any {
+	return a.node("ReturnStatement", stmt.Span(), jsonNode{"value": a.expression(stmt.Value)})
+}
+
+func (a *AstJSONPrinter) visitYieldStmt(stmt YieldStatement) Any {
+	return a.node("YieldStatement", stmt.Span(), jsonNode{"value": a.expression(stmt.Value)})
+}
+
+func (a *AstJSONPrinter) visitMatchStmt(stmt MatchStatement) Any {
+	arms := make([]Any, 0, len(stmt.Arms))
+	for _, arm := range stmt.Arms {
+		arms = append(arms, a.node("MatchArm", arm.Span(), jsonNode{
+			"patterns": a.patterns(arm.Patterns),
+			"guard":    a.expression(arm.Guard),
+			"body":     a.statement(arm.Body),
+		}))
+	}
+	return a.node("MatchStatement", stmt.Span(), jsonNode{
+		"subject": a.expression(stmt.Subject),
+		"arms":    arms,
+	})
+}
+
+func (a *AstJSONPrinter) visitErrorStmt(stmt ErrorStatement) Any {
+	return a.node("ErrorStatement", stmt.Span(), jsonNode{})
+}
+
+func (a *AstJSONPrinter) visitWildcardPattern(pattern WildcardPattern) Any {
+	return a.node("WildcardPattern", pattern.Span(), jsonNode{})
+}
+
+func (a *AstJSONPrinter) visitLiteralPattern(pattern LiteralPattern) Any {
+	return a.node("LiteralPattern", pattern.Span(), jsonNode{"value": pattern.Value})
+}
+
+func (a *AstJSONPrinter) visitBindingPattern(pattern BindingPattern) Any {
+	return a.node("BindingPattern", pattern.Span(), jsonNode{"name": pattern.Name.Lexeme})
+}
+
+func (a *AstJSONPrinter) visitTypePattern(pattern TypePattern) Any {
+	return a.node("TypePattern", pattern.Span(), jsonNode{
+		"name": pattern.Name.Lexeme,
+		"type": pattern.TypeName.Lexeme,
+	})
+}
+
+func (a *AstJSONPrinter) visitListPattern(pattern ListPattern) Any {
+	return a.node("ListPattern", pattern.Span(), jsonNode{"elements": a.patterns(pattern.Elements)})
+}
+
+func (a *AstJSONPrinter) visitMapPattern(pattern MapPattern) Any {
+	return a.node("MapPattern", pattern.Span(), jsonNode{
+		"keys":   pattern.Keys,
+		"values": a.patterns(pattern.Values),
+	})
+}
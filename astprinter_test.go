@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const everyNode = `var a = -(1 + 2) * 3;
+a = [1, "two", nil];
+fun gen(n) { yield n; yield; }
+fun f(x) { if (x) return x; else return; }
+while (false) { f(a); }
+for (k, v in {"a": 1, "b": 0..<2}) print v;
+match (a) {
+  [1, _], {"k": true} => print 1;
+  n: number if n > 1 => {}
+  -1 => { print 1 +; }
+  other => print other;
+}
+`
+
+func TestAstPrinter_SExpressions(t *testing.T) {
+	stmts, _ := parse(everyNode)
+	got := (&AstPrinter{}).PrintProgram(stmts)
+	want := `(var a (* (- (group (+ 1 2))) 3))
+(expr (= a (list 1 "two" nil)))
+(generator gen (n) (yield n) (yield))
+(fun f (x) (if x (return x) (return)))
+(while false (block (expr (call f a))))
+(for (k v) (map ("a" 1) ("b" (..< 0 2))) (print v))
+(match a (arm ((list 1 _) (map ("k" true))) (print 1)) (arm ((: n number)) (if (> n 1)) (block)) (arm (-1) (block (error))) (arm (other) (print other)))
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAstPrinter_JSON(t *testing.T) {
+	stmts, _ := parse(everyNode)
+	output, err := (&AstJSONPrinter{}).Print(stmts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tree map[string]any
+	if err := json.Unmarshal([]byte(output), &tree); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := map[string]bool{}
+	var walk func(value any)
+	walk = func(value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			if kind, ok := v["kind"].(string); ok {
+				kinds[kind] = true
+				if _, ok := v["span"].(map[string]any); !ok && kind != "Program" {
+					t.Errorf("%s has no span", kind)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(tree)
+
+	for _, kind := range strings.Fields(`Program VarStatement UnaryExpression GroupingExpression
+		BinaryExpression LiteralExpression AssignExpression ListExpression FunctionStatement
+		YieldStatement IfStatement ReturnStatement VariableExpression WhileStatement BlockStatement
+		ExpressionStatement CallExpression ForInStatement MapExpression RangeExpression
+		PrintStatement MatchStatement MatchArm ListPattern LiteralPattern WildcardPattern
+		MapPattern TypePattern BindingPattern ErrorStatement`) {
+		if !kinds[kind] {
+			t.Errorf("no %s in output", kind)
+		}
+	}
+}
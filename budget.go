@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+	Budgets
+
+	Host code running untrusted scripts can bound the work they do with the
+	Interpreter fields MaxSteps, Deadline and MaxAllocation. Each is off when
+	zero. A program that exceeds one stops with a BudgetError, which
+	Interpret returns so that the host can tell it from the script's own
+	runtime errors.
+
+	A step is a function call or a jump back to the start of a loop, which
+	is what both engines check, so that every program that runs for long
+	also takes many steps: `while (true) {}` exhausts any budget. The
+	deadline is checked every DEADLINE_INTERVAL steps. Allocation is counted
+	in approximate bytes for the strings built by `+` and for list and map
+	literals; it is never given back, so it bounds the garbage a program
+	creates as well as what it keeps. Native functions count what they
+	return, such as the contents of the files readFile reads.
+
+	Steps and allocation are counted across everything an interpreter runs,
+	so a budget set for a REPL session covers the whole session. Hosts that
+	want a budget per program call ResetBudget before running each one.
+
+	The same checks stop a program run with InterpretContext once its
+	context is done.
+*/
+
+// DEADLINE_INTERVAL is how many steps run between checks of the deadline.
+const DEADLINE_INTERVAL = 256
+
+// Approximate sizes in bytes of a list element and a map entry.
+const (
+	ELEMENT_SIZE = 16
+	ENTRY_SIZE   = 48
+)
+
+type Limit int
+
+const (
+	LIMIT_STEPS Limit = iota
+	LIMIT_DEADLINE
+	LIMIT_ALLOCATION
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LIMIT_STEPS:
+		return "Step limit exceeded."
+	case LIMIT_DEADLINE:
+		return "Time limit exceeded."
+	default:
+		return "Allocation limit exceeded."
+	}
+}
+
+// BudgetError stops a program that exceeded one of the limits of its
+// interpreter.
+type BudgetError struct {
+	Limit Limit
+	token Token
+}
+
+func (e BudgetError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.token.Line, e.token.Column, e.Limit)
+}
+
+// spent is what the programs of an interpreter have used of its budget. It
+// is shared with the copies of the interpreter running generators.
+type spent struct {
+	steps     int
+	allocated int
+}
+
+// step counts a call or loop iteration at token against the budget, and
+// stops the program if its context is done.
+func (i *Interpreter) step(token Token) {
+	limits := i.root()
+	select {
+	case <-limits.ctx.Done():
+		err := limits.ctx.Err()
+		panic(RuntimeError{token: token, message: "Execution stopped: " + err.Error() + ".", cause: err})
+	default:
+	}
+	i.used.steps++
+	if limits.MaxSteps > 0 && i.used.steps > limits.MaxSteps {
+		panic(BudgetError{Limit: LIMIT_STEPS, token: token})
+	}
+	if !limits.Deadline.IsZero() && i.used.steps%DEADLINE_INTERVAL == 0 && time.Now().After(limits.Deadline) {
+		panic(BudgetError{Limit: LIMIT_DEADLINE, token: token})
+	}
+}
+
+// ResetBudget forgets the steps and allocation counted so far, so that the
+// next program run gets the whole of MaxSteps and MaxAllocation.
+func (i *Interpreter) ResetBudget() {
+	*i.used = spent{}
+}
+
+// allocate counts size bytes allocated at token against the budget. Native
+// functions pass the zero Token, and the BudgetError is reported at their
+// call.
+func (i *Interpreter) allocate(token Token, size int) {
+	i.used.allocated += size
+	if limit := i.root().MaxAllocation; limit > 0 && i.used.allocated > limit {
+		panic(BudgetError{Limit: LIMIT_ALLOCATION, token: token})
+	}
+}
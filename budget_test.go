@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// interpretWith runs source with a fresh interpreter set up by configure
+// on the given engine, and returns the error that stopped it.
+func interpretWith(t *testing.T, engine string, source string, configure func(*Interpreter)) error {
+	return interpretContext(t, context.Background(), engine, source, configure)
+}
+
+func interpretContext(t *testing.T, ctx context.Context, engine string, source string, configure func(*Interpreter)) error {
+	t.Helper()
+	newSession(t)
+	configure(interpreter)
+	return runProgram(t, ctx, engine, source)
+}
+
+// runProgram compiles source and runs it with the session's interpreter on
+// engine.
+func runProgram(t *testing.T, ctx context.Context, engine string, source string) error {
+	t.Helper()
+	stmts := compile("<test>", source)
+	if stmts == nil {
+		t.Fatal("script has errors")
+	}
+	if engine == ENGINE_VM {
+		return NewVM(interpreter).InterpretContext(ctx, NewCompiler().Compile(stmts))
+	}
+	return interpreter.InterpretContext(ctx, stmts)
+}
+
+func TestBudget(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		configure func(*Interpreter)
+		want      Limit
+		line      int
+	}{
+		{"empty loop", "while (true) {}",
+			func(i *Interpreter) { i.MaxSteps = 1000 }, LIMIT_STEPS, 1},
+		{"for-in", "for (n in 0..1000000) {}",
+			func(i *Interpreter) { i.MaxSteps = 1000 }, LIMIT_STEPS, 1},
+		{"recursion", "fun f(n) {\n  return f(n + 1);\n}\nf(0);",
+			func(i *Interpreter) { i.MaxSteps = 1000 }, LIMIT_STEPS, 2},
+		{"generator", "fun g() { while (true) yield 1; }\nfor (v in g()) {}",
+			func(i *Interpreter) { i.MaxSteps = 1000 }, LIMIT_STEPS, 1},
+		{"deadline", "while (true) {}",
+			func(i *Interpreter) { i.Deadline = time.Now().Add(10 * time.Millisecond) }, LIMIT_DEADLINE, 1},
+		{"strings", "var s = \"ab\";\nwhile (true) s = s + s;",
+			func(i *Interpreter) { i.MaxAllocation = 1 << 20 }, LIMIT_ALLOCATION, 2},
+		{"lists", "while (true) {\n  var l = [1, 2, 3];\n}",
+			func(i *Interpreter) { i.MaxAllocation = 1 << 20 }, LIMIT_ALLOCATION, 2},
+		{"maps", "while (true) {\n  var m = {\"a\": 1};\n}",
+			func(i *Interpreter) { i.MaxAllocation = 1 << 20 }, LIMIT_ALLOCATION, 2},
+		{"files", "var s = \"\";\nwhile (true) s = readFile(\"tests/generators.gs\");",
+			func(i *Interpreter) {
+				i.Permissions = Unrestricted()
+				i.MaxAllocation = 1 << 20
+			}, LIMIT_ALLOCATION, 2},
+	}
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		for _, test := range tests {
+			t.Run(engine+"/"+test.name, func(t *testing.T) {
+				err := interpretWith(t, engine, test.source, test.configure)
+				var budgetErr BudgetError
+				if !errors.As(err, &budgetErr) {
+					t.Fatalf("got %v, want a BudgetError", err)
+				}
+				if budgetErr.Limit != test.want || budgetErr.token.Line != test.line {
+					t.Errorf("got %v, want %q on line %d", err, test.want, test.line)
+				}
+			})
+		}
+	}
+}
+
+func TestBudget_Unlimited(t *testing.T) {
+	source := "var s = \"\";\nfor (n in 1..10000) s = s + \"x\";"
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		err := interpretWith(t, engine, source, func(i *Interpreter) {})
+		if err != nil {
+			t.Errorf("%s: %v", engine, err)
+		}
+		var runtimeErr RuntimeError
+		err = interpretWith(t, engine, source+"\nprint -s;", func(i *Interpreter) { i.MaxSteps = 20000 })
+		if !errors.As(err, &runtimeErr) {
+			t.Errorf("%s: got %v, want a RuntimeError", engine, err)
+		}
+	}
+}
+
+// cancelFn cancels the context it is called with.
+type cancelFn struct {
+	cancel context.CancelFunc
+	called context.Context
+}
+
+func (fn *cancelFn) Arity() int {
+	return 0
+}
+
+func (fn *cancelFn) Call(interpreter *Interpreter, arguments []Any) Any {
+	panic("Call instead of CallContext")
+}
+
+func (fn *cancelFn) CallContext(ctx context.Context, interpreter *Interpreter, arguments []Any) Any {
+	fn.called = ctx
+	fn.cancel()
+	return nil
+}
+
+func TestInterpretContext(t *testing.T) {
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		t.Run(engine+"/timeout", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			err := interpretContext(t, ctx, engine, "while (true) {}", func(i *Interpreter) {})
+			var runtimeErr RuntimeError
+			if !errors.As(err, &runtimeErr) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got %v, want a RuntimeError wrapping %v", err, context.DeadlineExceeded)
+			}
+		})
+		t.Run(engine+"/native", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			fn := &cancelFn{cancel: cancel}
+			err := interpretContext(t, ctx, engine, "stop();\nwhile (true) {}", func(i *Interpreter) {
+				i.globals.define("stop", fn)
+			})
+			if fn.called != ctx {
+				t.Errorf("native got context %v", fn.called)
+			}
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v, want %v", err, context.Canceled)
+			}
+		})
+	}
+}
+
+// Limits set after a generator started apply when it is resumed.
+func TestBudget_ChangedLimits(t *testing.T) {
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		newSession(t)
+		if err := runProgram(t, context.Background(), engine, "fun g() { yield 1; while (true) {} }\nvar it = g();\nit();"); err != nil {
+			t.Fatal(err)
+		}
+		interpreter.MaxSteps = 1000
+		var budgetErr BudgetError
+		if err := runProgram(t, context.Background(), engine, "it();"); !errors.As(err, &budgetErr) || budgetErr.Limit != LIMIT_STEPS {
+			t.Errorf("%s: got %v, want %q", engine, err, LIMIT_STEPS)
+		}
+	}
+}
+
+func TestBudget_Reset(t *testing.T) {
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		newSession(t)
+		interpreter.MaxSteps = 1500
+		source := "for (n in 1..1000) {}"
+		if err := runProgram(t, context.Background(), engine, source); err != nil {
+			t.Fatal(err)
+		}
+		if err := runProgram(t, context.Background(), engine, source); err == nil {
+			t.Errorf("%s: the second program ran within the budget of both", engine)
+		}
+		interpreter.ResetBudget()
+		if err := runProgram(t, context.Background(), engine, source); err != nil {
+			t.Errorf("%s: %v after ResetBudget", engine, err)
+		}
+	}
+}
+
+// A generator resumed by a program runs under that program's context, not
+// the one it started under.
+func TestInterpretContext_Generator(t *testing.T) {
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		newSession(t)
+		first, cancel := context.WithCancel(context.Background())
+		source := "fun g() { while (true) { for (n in 1..10) {} yield 1; } }\nvar it = g();\nit();"
+		if err := runProgram(t, first, engine, source); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := runProgram(t, context.Background(), engine, "it();"); err != nil {
+			t.Errorf("%s: %v, resumed under a live context", engine, err)
+		}
+		if err := runProgram(t, first, engine, "it();"); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: got %v resumed under a cancelled context, want %v", engine, err, context.Canceled)
+		}
+	}
+}
@@ -1,6 +1,25 @@
 package main
 
+import "context"
+
 type Callable interface {
 	Arity() int
 	Call(interpreter *Interpreter, arguments []Any) Any
 }
+
+// ContextCallable is implemented by native functions that take the context
+// the program runs with, so that they can give up on slow work such as I/O
+// when it is cancelled. CallContext is called instead of Call.
+type ContextCallable interface {
+	Callable
+	CallContext(ctx context.Context, interpreter *Interpreter, arguments []Any) Any
+}
+
+// invoke calls a native function, passing it the program's context if it
+// takes one.
+func (i *Interpreter) invoke(function Callable, arguments []Any) Any {
+	if f, ok := function.(ContextCallable); ok {
+		return f.CallContext(i.root().ctx, i, arguments)
+	}
+	return function.Call(i, arguments)
+}
@@ -0,0 +1,151 @@
+package main
+
+/*
+	Bytecode
+
+	`gs run --engine=vm` compiles the resolved program into bytecode (see
+	compiler.go) and runs it on a stack machine (see vm.go) instead of
+	walking the syntax tree. Both engines implement the same language and
+	report the same errors at the same places.
+
+	Every function is compiled to its own Chunk. An instruction is an opcode
+	byte followed by its operands, each one byte unless noted:
+
+	  CONSTANT c16         push constants[c]
+	  NIL, TRUE, FALSE     push the value
+	  POP                  drop the top of the stack
+	  GET_LOCAL s          push the local in slot s of the frame
+	  SET_LOCAL s          store the top of the stack in slot s
+	  GET_GLOBAL c16       push the global named constants[c]
+	  DEFINE_GLOBAL c16    pop into a new global named constants[c]
+	  SET_GLOBAL c16       store the top of the stack in an existing global
+	  GET_UPVALUE u        push upvalue u of the running closure
+	  SET_UPVALUE u        store the top of the stack in upvalue u
+	  EQUAL ... NEGATE     pop the operands and push the result
+	  RANGE i              pop start and end and push a range, inclusive if i
+	  KEY                  check that the top of the stack can be a map key
+	  LIST n16, MAP n16    pop n elements or key-value pairs into a collection
+	  PRINT                pop and print
+	  JUMP o16             skip forward o bytes
+	  JUMP_IF_FALSE o16    pop and skip forward o bytes if falsey
+	  LOOP o16             jump back o bytes
+	  CALL n               call the value below the n arguments
+	  TAIL_CALL n          like CALL, but a compiled function called this way
+	                       replaces the returning frame instead of adding one
+	  CLOSURE c16 (l i)*   push a closure of constants[c], capturing for
+	                       every upvalue local slot i, or upvalue i of the
+	                       enclosing closure if l is 0
+	  CLOSE_UPVALUE        move the captured top of the stack to the heap
+	  RETURN               return the top of the stack to the caller
+	  ITERATE p            replace the top of the stack with an iterator
+	                       over it, of (key, value) pairs if p
+	  NEXT s o16           push the next value(s) of the iterator in slot s,
+	                       or skip forward o bytes when it is exhausted
+	  MATCH s c16          match the local in slot s against the arm
+	                       constants[c], binding its variables; push the result
+	  YIELD                pop and suspend the generator
+	  FAIL c16             raise the runtime error constants[c]
+
+	Multi-byte operands are big-endian. Every byte of code remembers the
+	token it was compiled from so that runtime errors can be reported at the
+	same place as by the tree-walker.
+*/
+
+type OpCode byte
+
+const (
+	OP_CONSTANT OpCode = iota
+	OP_NIL
+	OP_TRUE
+	OP_FALSE
+	OP_POP
+	OP_GET_LOCAL
+	OP_SET_LOCAL
+	OP_GET_GLOBAL
+	OP_DEFINE_GLOBAL
+	OP_SET_GLOBAL
+	OP_GET_UPVALUE
+	OP_SET_UPVALUE
+	OP_EQUAL
+	OP_NOT_EQUAL
+	OP_GREATER
+	OP_GREATER_EQUAL
+	OP_LESS
+	OP_LESS_EQUAL
+	OP_ADD
+	OP_SUBTRACT
+	OP_MULTIPLY
+	OP_DIVIDE
+	OP_NOT
+	OP_NEGATE
+	OP_RANGE
+	OP_KEY
+	OP_LIST
+	OP_MAP
+	OP_PRINT
+	OP_JUMP
+	OP_JUMP_IF_FALSE
+	OP_LOOP
+	OP_CALL
+	OP_TAIL_CALL
+	OP_CLOSURE
+	OP_CLOSE_UPVALUE
+	OP_RETURN
+	OP_ITERATE
+	OP_NEXT
+	OP_MATCH
+	OP_YIELD
+	OP_FAIL
+)
+
+type Chunk struct {
+	code      []byte
+	constants []Any
+	// tokens holds the token every byte of code was compiled from
+	tokens []Token
+	// indexes maps hashable constants to their index so that names and
+	// repeated literals are stored once
+	indexes map[Any]int
+}
+
+func NewChunk() *Chunk {
+	return &Chunk{indexes: make(map[Any]int)}
+}
+
+func (c *Chunk) write(b byte, token Token) {
+	c.code = append(c.code, b)
+	c.tokens = append(c.tokens, token)
+}
+
+// addConstant returns the index of value in the constant pool, adding it if
+// needed.
+func (c *Chunk) addConstant(value Any) int {
+	hashable := isHashable(value)
+	if hashable {
+		if n, ok := c.indexes[value]; ok {
+			return n
+		}
+	}
+	c.constants = append(c.constants, value)
+	n := len(c.constants) - 1
+	if hashable {
+		c.indexes[value] = n
+	}
+	return n
+}
+
+// vmFunction is a compiled function declaration.
+type vmFunction struct {
+	name         string
+	params       []string
+	upvalueCount int
+	generator    bool
+	chunk        *Chunk
+}
+
+// vmArm is the constant operand of OP_MATCH: the patterns of a match arm
+// and the frame slots of the variables they bind.
+type vmArm struct {
+	patterns []Pattern
+	slots    map[string]int
+}
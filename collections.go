@@ -0,0 +1,85 @@
+package main
+
+import "strings"
+
+// List is the runtime representation of a script list. It is always handled
+// by pointer so that lists have reference semantics and stay comparable.
+type List struct {
+	Elements []Any
+}
+
+func NewList(elements []Any) *List {
+	return &List{Elements: elements}
+}
+
+func (l *List) Len() int {
+	return len(l.Elements)
+}
+
+// Map is the runtime representation of a script map. Keys keep their
+// insertion order so that printing and iterating a map is deterministic.
+type Map struct {
+	keys   []Any
+	values map[Any]Any
+}
+
+func NewMap() *Map {
+	return &Map{values: make(map[Any]Any)}
+}
+
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+func (m *Map) Keys() []Any {
+	return m.keys
+}
+
+func (m *Map) Get(key Any) (Any, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+func (m *Map) Set(key Any, value Any) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// isHashable reports whether value can be used as a map key.
+func isHashable(value Any) bool {
+	switch value.(type) {
+	case float64, string, bool:
+		return true
+	}
+	return false
+}
+
+func (i *Interpreter) stringifyList(list *List) string {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for n, e := range list.Elements {
+		if n > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(i.stringify(e))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+func (i *Interpreter) stringifyMap(m *Map) string {
+	var sb strings.Builder
+	sb.WriteString("{")
+	for n, k := range m.keys {
+		if n > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(i.stringify(k))
+		sb.WriteString(": ")
+		sb.WriteString(i.stringify(m.values[k]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
@@ -0,0 +1,605 @@
+package main
+
+import "math"
+
+// local is a variable living in a slot of the frame of the function being
+// compiled.
+type local struct {
+	name string
+	// depth is the scope depth of the declaration, or -1 while the
+	// variable's initializer is compiled
+	depth int
+	// captured is set when a closure refers to the variable, so that
+	// leaving its scope moves it to the heap rather than dropping it
+	captured bool
+}
+
+type upvalueRef struct {
+	index   byte
+	isLocal bool
+}
+
+// functionCompiler holds the state of one function being compiled. Function
+// declarations nest, and so do their compilers.
+type functionCompiler struct {
+	enclosing  *functionCompiler
+	function   *vmFunction
+	locals     []local
+	upvalues   []upvalueRef
+	scopeDepth int
+}
+
+// Compiler turns a resolved program into bytecode for the VM. It relies on
+// the Resolver having rejected invalid programs, and reports only the limits
+// of the bytecode format.
+type Compiler struct {
+	current *functionCompiler
+}
+
+func NewCompiler() *Compiler {
+	return &Compiler{}
+}
+
+// Compile compiles a program into the function running it, or returns nil
+// if it exceeds the limits of the VM.
+func (c *Compiler) Compile(statements []Statement) *vmFunction {
+	c.beginFunction("script", false)
+	for _, statement := range statements {
+		c.compileStmt(statement)
+	}
+	end := Token{TokenType: TT_EOF}
+	c.emit(end, OP_NIL)
+	c.emit(end, OP_RETURN)
+	function, _ := c.endFunction()
+	if hadError {
+		return nil
+	}
+	return function
+}
+
+func (c *Compiler) beginFunction(name string, generator bool) {
+	c.current = &functionCompiler{
+		enclosing: c.current,
+		function:  &vmFunction{name: name, generator: generator, chunk: NewChunk()},
+		// slot 0 holds the function being called
+		locals: []local{{name: "", depth: 0}},
+	}
+}
+
+func (c *Compiler) endFunction() (*vmFunction, []upvalueRef) {
+	compiler := c.current
+	c.current = compiler.enclosing
+	compiler.function.upvalueCount = len(compiler.upvalues)
+	return compiler.function, compiler.upvalues
+}
+
+func (c *Compiler) compileStmt(stmt Statement) {
+	stmt.Accept(c)
+}
+
+func (c *Compiler) compileExpr(expr Expression) {
+	expr.Accept(c)
+}
+
+/*
+	Emitting code
+*/
+
+func (c *Compiler) chunk() *Chunk {
+	return c.current.function.chunk
+}
+
+func (c *Compiler) emit(token Token, bytes ...any) {
+	for _, b := range bytes {
+		switch b := b.(type) {
+		case OpCode:
+			c.chunk().write(byte(b), token)
+		case byte:
+			c.chunk().write(b, token)
+		}
+	}
+}
+
+func (c *Compiler) emitShort(token Token, n int) {
+	c.emit(token, byte(n>>8), byte(n))
+}
+
+func (c *Compiler) emitConstant(token Token, op OpCode, value Any) {
+	c.emit(token, op)
+	c.emitShort(token, c.constant(token, value))
+}
+
+func (c *Compiler) constant(token Token, value Any) int {
+	n := c.chunk().addConstant(value)
+	if n > math.MaxUint16 {
+		parseFault(token, "Too many constants in one chunk.")
+		return 0
+	}
+	return n
+}
+
+// emitJump emits a forward jump and returns the position of its offset for
+// patchJump to fill in.
+func (c *Compiler) emitJump(token Token, op OpCode) int {
+	c.emit(token, op)
+	c.emitShort(token, 0)
+	return len(c.chunk().code) - 2
+}
+
+func (c *Compiler) patchJump(token Token, at int) {
+	offset := len(c.chunk().code) - at - 2
+	if offset > math.MaxUint16 {
+		parseFault(token, "Too much code to jump over.")
+	}
+	c.chunk().code[at] = byte(offset >> 8)
+	c.chunk().code[at+1] = byte(offset)
+}
+
+func (c *Compiler) emitLoop(token Token, start int) {
+	c.emit(token, OP_LOOP)
+	offset := len(c.chunk().code) - start + 2
+	if offset > math.MaxUint16 {
+		parseFault(token, "Loop body too large.")
+	}
+	c.emitShort(token, offset)
+}
+
+/*
+	Variables
+*/
+
+func (c *Compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+// endScope leaves a scope, discarding its locals at runtime.
+func (c *Compiler) endScope(token Token) {
+	c.current.scopeDepth--
+	locals := c.current.locals
+	for len(locals) > 0 && locals[len(locals)-1].depth > c.current.scopeDepth {
+		if locals[len(locals)-1].captured {
+			c.emit(token, OP_CLOSE_UPVALUE)
+		} else {
+			c.emit(token, OP_POP)
+		}
+		locals = locals[:len(locals)-1]
+	}
+	c.current.locals = locals
+}
+
+// addLocal declares a local in the next free slot and returns the slot.
+func (c *Compiler) addLocal(name Token, initialized bool) int {
+	if len(c.current.locals) > math.MaxUint8 {
+		parseFault(name, "Too many local variables in function.")
+		return 0
+	}
+	depth := c.current.scopeDepth
+	if !initialized {
+		depth = -1
+	}
+	c.current.locals = append(c.current.locals, local{name: name.Lexeme, depth: depth})
+	return len(c.current.locals) - 1
+}
+
+// markInitialized makes the most recently declared local visible.
+func (c *Compiler) markInitialized() {
+	c.current.locals[len(c.current.locals)-1].depth = c.current.scopeDepth
+}
+
+// hiddenLocal reserves a slot for a value the program can't name, like the
+// subject of a match.
+func (c *Compiler) hiddenLocal(token Token) int {
+	token.Lexeme = ""
+	return c.addLocal(token, true)
+}
+
+func resolveLocal(compiler *functionCompiler, name string) int {
+	for n := len(compiler.locals) - 1; n > 0; n-- {
+		if compiler.locals[n].name == name {
+			return n
+		}
+	}
+	return -1
+}
+
+// resolveUpvalue finds name in the enclosing functions and returns the
+// index of the upvalue capturing it, or -1 if it is a global.
+func (c *Compiler) resolveUpvalue(compiler *functionCompiler, name Token) int {
+	if compiler.enclosing == nil {
+		return -1
+	}
+	if slot := resolveLocal(compiler.enclosing, name.Lexeme); slot >= 0 {
+		compiler.enclosing.locals[slot].captured = true
+		return c.addUpvalue(compiler, name, byte(slot), true)
+	}
+	if index := c.resolveUpvalue(compiler.enclosing, name); index >= 0 {
+		return c.addUpvalue(compiler, name, byte(index), false)
+	}
+	return -1
+}
+
+func (c *Compiler) addUpvalue(compiler *functionCompiler, name Token, index byte, isLocal bool) int {
+	for n, upvalue := range compiler.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return n
+		}
+	}
+	if len(compiler.upvalues) > math.MaxUint8 {
+		parseFault(name, "Too many closure variables in function.")
+		return 0
+	}
+	compiler.upvalues = append(compiler.upvalues, upvalueRef{index: index, isLocal: isLocal})
+	return len(compiler.upvalues) - 1
+}
+
+// variable emits the get or set instruction for name.
+func (c *Compiler) variable(name Token, set bool) {
+	if slot := resolveLocal(c.current, name.Lexeme); slot >= 0 {
+		c.emit(name, pick(set, OP_SET_LOCAL, OP_GET_LOCAL), byte(slot))
+	} else if index := c.resolveUpvalue(c.current, name); index >= 0 {
+		c.emit(name, pick(set, OP_SET_UPVALUE, OP_GET_UPVALUE), byte(index))
+	} else {
+		c.emitConstant(name, pick(set, OP_SET_GLOBAL, OP_GET_GLOBAL), name.Lexeme)
+	}
+}
+
+func pick(cond bool, yes OpCode, no OpCode) OpCode {
+	if cond {
+		return yes
+	}
+	return no
+}
+
+/*
+	Expressions
+*/
+
+func (c *Compiler) visitBinaryExpr(expr BinaryExpression) Any {
+	c.compileExpr(expr.Left)
+	c.compileExpr(expr.Right)
+	switch expr.Operator.TokenType {
+	case TT_GREATER:
+		c.emit(expr.Operator, OP_GREATER)
+	case TT_GREATER_EQUAL:
+		c.emit(expr.Operator, OP_GREATER_EQUAL)
+	case TT_LESS:
+		c.emit(expr.Operator, OP_LESS)
+	case TT_LESS_EQUAL:
+		c.emit(expr.Operator, OP_LESS_EQUAL)
+	case TT_MINUS:
+		c.emit(expr.Operator, OP_SUBTRACT)
+	case TT_SLASH:
+		c.emit(expr.Operator, OP_DIVIDE)
+	case TT_STAR:
+		c.emit(expr.Operator, OP_MULTIPLY)
+	case TT_PLUS:
+		c.emit(expr.Operator, OP_ADD)
+	case TT_BANG_EQUAL:
+		c.emit(expr.Operator, OP_NOT_EQUAL)
+	case TT_EQUAL_EQUAL:
+		c.emit(expr.Operator, OP_EQUAL)
+	}
+	return nil
+}
+
+func (c *Compiler) visitGroupingExpr(expr GroupingExpression) Any {
+	c.compileExpr(expr.Expression)
+	return nil
+}
+
+func (c *Compiler) visitLiteralExpr(expr LiteralExpression) Any {
+	switch expr.Value {
+	case nil:
+		c.emit(expr.Token, OP_NIL)
+	case true:
+		c.emit(expr.Token, OP_TRUE)
+	case false:
+		c.emit(expr.Token, OP_FALSE)
+	default:
+		c.emitConstant(expr.Token, OP_CONSTANT, expr.Value)
+	}
+	return nil
+}
+
+func (c *Compiler) visitUnaryExpr(expr UnaryExpression) Any {
+	c.compileExpr(expr.Right)
+	switch expr.Operator.TokenType {
+	case TT_MINUS:
+		c.emit(expr.Operator, OP_NEGATE)
+	case TT_BANG:
+		c.emit(expr.Operator, OP_NOT)
+	}
+	return nil
+}
+
+func (c *Compiler) visitVarExpr(expr *VariableExpression) Any {
+	c.variable(expr.Name, false)
+	return nil
+}
+
+func (c *Compiler) visitAssignExpr(expr *AssignExpression) Any {
+	c.compileExpr(expr.Value)
+	c.variable(expr.Name, true)
+	return nil
+}
+
+func (c *Compiler) visitCallExpr(expr CallExpression) Any {
+	c.compileExpr(expr.Callee)
+	for _, arg := range expr.Arguments {
+		c.compileExpr(arg)
+	}
+	c.emit(expr.Paren, OP_CALL, byte(len(expr.Arguments)))
+	return nil
+}
+
+func (c *Compiler) visitListExpr(expr ListExpression) Any {
+	if len(expr.Elements) > math.MaxUint16 {
+		parseFault(expr.Bracket, "Too many elements in list literal.")
+	}
+	for _, element := range expr.Elements {
+		c.compileExpr(element)
+	}
+	c.emit(expr.Bracket, OP_LIST)
+	c.emitShort(expr.Bracket, len(expr.Elements))
+	return nil
+}
+
+func (c *Compiler) visitMapExpr(expr MapExpression) Any {
+	if len(expr.Keys) > math.MaxUint16 {
+		parseFault(expr.Brace, "Too many entries in map literal.")
+	}
+	for n := range expr.Keys {
+		c.compileExpr(expr.Keys[n])
+		c.emit(expr.Brace, OP_KEY)
+		c.compileExpr(expr.Values[n])
+	}
+	c.emit(expr.Brace, OP_MAP)
+	c.emitShort(expr.Brace, len(expr.Keys))
+	return nil
+}
+
+func (c *Compiler) visitRangeExpr(expr RangeExpression) Any {
+	c.compileExpr(expr.Start)
+	c.compileExpr(expr.End)
+	inclusive := byte(0)
+	if expr.Operator.TokenType == TT_DOT_DOT {
+		inclusive = 1
+	}
+	c.emit(expr.Operator, OP_RANGE, inclusive)
+	return nil
+}
+
+func (c *Compiler) visitErrorExpr(expr ErrorExpression) Any {
+	c.emitConstant(expr.Token, OP_FAIL, "Can't evaluate code with syntax errors.")
+	return nil
+}
+
+/*
+	Statements
+*/
+
+func (c *Compiler) visitExprStmt(stmt ExpressionStatement) Any {
+	c.compileExpr(stmt.Expression)
+	c.emit(stmt.Semicolon, OP_POP)
+	return nil
+}
+
+func (c *Compiler) visitPrintStmt(stmt PrintStatement) Any {
+	c.compileExpr(stmt.Expression)
+	c.emit(stmt.Keyword, OP_PRINT)
+	return nil
+}
+
+func (c *Compiler) visitVarStmt(stmt VarStatement) Any {
+	if c.current.scopeDepth > 0 {
+		c.addLocal(stmt.Name, false)
+	}
+	if stmt.Initializer != nil {
+		c.compileExpr(stmt.Initializer)
+	} else {
+		c.emit(stmt.Name, OP_NIL)
+	}
+	if c.current.scopeDepth > 0 {
+		c.markInitialized()
+	} else {
+		c.emitConstant(stmt.Name, OP_DEFINE_GLOBAL, stmt.Name.Lexeme)
+	}
+	return nil
+}
+
+func (c *Compiler) visitBlockStmt(stmt BlockStatement) Any {
+	c.beginScope()
+	for _, statement := range stmt.Statements {
+		c.compileStmt(statement)
+	}
+	c.endScope(stmt.RightBrace)
+	return nil
+}
+
+func (c *Compiler) visitIfStmt(stmt IfStatement) Any {
+	c.compileExpr(stmt.Condition)
+	elseJump := c.emitJump(stmt.Keyword, OP_JUMP_IF_FALSE)
+	c.compileStmt(stmt.ThenBlock)
+	if stmt.ElseBlock == nil {
+		c.patchJump(stmt.Keyword, elseJump)
+		return nil
+	}
+	endJump := c.emitJump(stmt.Keyword, OP_JUMP)
+	c.patchJump(stmt.Keyword, elseJump)
+	c.compileStmt(stmt.ElseBlock)
+	c.patchJump(stmt.Keyword, endJump)
+	return nil
+}
+
+func (c *Compiler) visitWhileStmt(stmt WhileStatement) Any {
+	start := len(c.chunk().code)
+	c.compileExpr(stmt.Condition)
+	exitJump := c.emitJump(stmt.Keyword, OP_JUMP_IF_FALSE)
+	c.compileStmt(stmt.Body)
+	c.emitLoop(stmt.Keyword, start)
+	c.patchJump(stmt.Keyword, exitJump)
+	return nil
+}
+
+func (c *Compiler) visitForInStmt(stmt ForInStatement) Any {
+	pairs := len(stmt.Variables) == 2
+	c.beginScope()
+	c.compileExpr(stmt.Iterable)
+	c.emit(stmt.In, OP_ITERATE, boolByte(pairs))
+	iterator := c.hiddenLocal(stmt.In)
+
+	start := len(c.chunk().code)
+	c.emit(stmt.In, OP_NEXT, byte(iterator))
+	c.emitShort(stmt.In, 0)
+	exitJump := len(c.chunk().code) - 2
+
+	// every iteration gets fresh variables for closures to capture
+	c.beginScope()
+	for _, variable := range stmt.Variables {
+		c.addLocal(variable, true)
+	}
+	c.compileStmt(stmt.Body)
+	c.endScope(stmt.Keyword)
+	c.emitLoop(stmt.Keyword, start)
+
+	c.patchJump(stmt.Keyword, exitJump)
+	c.endScope(stmt.Keyword)
+	return nil
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (c *Compiler) visitFunctionStmt(stmt FunctionStatement) Any {
+	global := c.current.scopeDepth == 0
+	if !global {
+		// initialized at once so that the function can call itself
+		c.addLocal(stmt.Name, true)
+	}
+
+	c.beginFunction(stmt.Name.Lexeme, stmt.Generator)
+	c.beginScope()
+	for _, param := range stmt.Params {
+		c.current.function.params = append(c.current.function.params, param.Lexeme)
+		c.addLocal(param, true)
+	}
+	for _, statement := range stmt.Body {
+		c.compileStmt(statement)
+	}
+	c.emit(stmt.RightBrace, OP_NIL)
+	c.emit(stmt.RightBrace, OP_RETURN)
+	function, upvalues := c.endFunction()
+
+	c.emitConstant(stmt.Name, OP_CLOSURE, function)
+	for _, upvalue := range upvalues {
+		c.emit(stmt.Name, boolByte(upvalue.isLocal), upvalue.index)
+	}
+	if global {
+		c.emitConstant(stmt.Name, OP_DEFINE_GLOBAL, stmt.Name.Lexeme)
+	}
+	return nil
+}
+
+func (c *Compiler) visitReturnStmt(stmt ReturnStatement) Any {
+	if call, ok := stmt.Value.(CallExpression); ok {
+		c.compileExpr(call.Callee)
+		for _, arg := range call.Arguments {
+			c.compileExpr(arg)
+		}
+		c.emit(call.Paren, OP_TAIL_CALL, byte(len(call.Arguments)))
+	} else if stmt.Value != nil {
+		c.compileExpr(stmt.Value)
+	} else {
+		c.emit(stmt.Keyword, OP_NIL)
+	}
+	c.emit(stmt.Keyword, OP_RETURN)
+	return nil
+}
+
+func (c *Compiler) visitYieldStmt(stmt YieldStatement) Any {
+	if stmt.Value != nil {
+		c.compileExpr(stmt.Value)
+	} else {
+		c.emit(stmt.Keyword, OP_NIL)
+	}
+	c.emit(stmt.Keyword, OP_YIELD)
+	return nil
+}
+
+// visitMatchStmt keeps the subject in a hidden local and tries the arms in
+// turn. Each arm reserves slots for its bindings, which OP_MATCH fills in.
+func (c *Compiler) visitMatchStmt(stmt MatchStatement) Any {
+	c.beginScope()
+	c.compileExpr(stmt.Subject)
+	subject := c.hiddenLocal(stmt.Keyword)
+
+	var endJumps []int
+	for _, arm := range stmt.Arms {
+		c.beginScope()
+		slots := make(map[string]int)
+		for _, pattern := range arm.Patterns {
+			for _, name := range patternBindings(pattern) {
+				c.emit(name, OP_NIL)
+				slots[name.Lexeme] = c.addLocal(name, true)
+			}
+		}
+		c.emit(arm.Arrow, OP_MATCH, byte(subject))
+		c.emitShort(arm.Arrow, c.constant(arm.Arrow, vmArm{patterns: arm.Patterns, slots: slots}))
+		failJumps := []int{c.emitJump(arm.Arrow, OP_JUMP_IF_FALSE)}
+		if arm.Guard != nil {
+			c.compileExpr(arm.Guard)
+			failJumps = append(failJumps, c.emitJump(arm.Arrow, OP_JUMP_IF_FALSE))
+		}
+		c.compileStmt(arm.Body)
+		c.endScope(arm.Arrow)
+		endJumps = append(endJumps, c.emitJump(arm.Arrow, OP_JUMP))
+
+		// the bindings of an arm that did not match were never captured
+		for _, at := range failJumps {
+			c.patchJump(arm.Arrow, at)
+		}
+		for range slots {
+			c.emit(arm.Arrow, OP_POP)
+		}
+	}
+
+	for _, at := range endJumps {
+		c.patchJump(stmt.Keyword, at)
+	}
+	c.endScope(stmt.RightBrace)
+	return nil
+}
+
+// patternBindings returns the variables pattern binds, in order.
+func patternBindings(pattern Pattern) []Token {
+	switch p := pattern.(type) {
+	case BindingPattern:
+		return []Token{p.Name}
+	case TypePattern:
+		if p.Name.TokenType == TT_IDENTIFIER {
+			return []Token{p.Name}
+		}
+	case ListPattern:
+		var names []Token
+		for _, element := range p.Elements {
+			names = append(names, patternBindings(element)...)
+		}
+		return names
+	case MapPattern:
+		var names []Token
+		for _, value := range p.Values {
+			names = append(names, patternBindings(value)...)
+		}
+		return names
+	}
+	return nil
+}
+
+func (c *Compiler) visitErrorStmt(stmt ErrorStatement) Any {
+	c.emitConstant(stmt.From, OP_FAIL, "Can't execute code with syntax errors.")
+	return nil
+}
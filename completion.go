@@ -0,0 +1,170 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+	Completion
+
+	Tab in the REPL completes the identifier before the cursor from the
+	variables visible to the interpreter, the keywords, and the names used in
+	the lines of a multi-line input entered so far. A unique completion is
+	inserted; otherwise the candidates' common prefix is, and if there is
+	none the candidates are listed. With the cursor in the arguments of a
+	call, Tab shows the signature of the function being called.
+*/
+
+// parameterized is implemented by callables that can name their parameters.
+type parameterized interface {
+	params() []string
+}
+
+func (f Function) params() []string {
+	names := make([]string, 0, len(f.Declaration.Params))
+	for _, param := range f.Declaration.Params {
+		names = append(names, param.Lexeme)
+	}
+	return names
+}
+
+func (fn clockFn) params() []string {
+	return nil
+}
+
+func (fn exitFn) params() []string {
+	return []string{"code"}
+}
+
+func (fn readFileFn) params() []string {
+	return []string{"path"}
+}
+
+func (fn envFn) params() []string {
+	return []string{"name"}
+}
+
+// signature returns name(params) for a callable value, or "" otherwise.
+func signature(name string, value Any) string {
+	if f, ok := value.(parameterized); ok {
+		return name + "(" + strings.Join(f.params(), ", ") + ")"
+	}
+	if f, ok := value.(Callable); ok {
+		params := make([]string, f.Arity())
+		for n := range params {
+			params[n] = "_"
+		}
+		return name + "(" + strings.Join(params, ", ") + ")"
+	}
+	return ""
+}
+
+// complete completes the line at pos, returning the new line and cursor
+// position, and a hint to show above the prompt or "".
+func (r *Repl) complete(line string, pos int) (string, int, string) {
+	start := pos
+	for start > 0 {
+		c, size := utf8.DecodeLastRuneInString(line[:start])
+		if !isIdentifierRune(c) {
+			break
+		}
+		start -= size
+	}
+	prefix := line[start:pos]
+	if prefix == "" {
+		if callee := enclosingCallee(line[:pos]); callee != "" {
+			return line, pos, signature(callee, r.lookup(callee))
+		}
+		return line, pos, ""
+	}
+
+	candidates := r.candidates(prefix)
+	switch len(candidates) {
+	case 0:
+		return line, pos, ""
+	case 1:
+		name := candidates[0]
+		return line[:start] + name + line[pos:], start + len(name), signature(name, r.lookup(name))
+	}
+	common := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	if len(common) > len(prefix) {
+		return line[:start] + common + line[pos:], start + len(common), ""
+	}
+	listed := make([]string, 0, len(candidates))
+	for _, name := range candidates {
+		if hint := signature(name, r.lookup(name)); hint != "" {
+			name = hint
+		}
+		listed = append(listed, name)
+	}
+	return line, pos, strings.Join(listed, "  ")
+}
+
+// candidates returns the sorted names starting with prefix.
+func (r *Repl) candidates(prefix string) []string {
+	names := interpreter.globals.names()
+	for keyword := range keywords {
+		names = append(names, keyword)
+	}
+	var tokens []Token
+	quietly(func() { tokens = NewScanner(r.pending).ScanTokens() })
+	for _, token := range tokens {
+		if token.TokenType == TT_IDENTIFIER {
+			names = append(names, token.Lexeme)
+		}
+	}
+
+	names = slices.DeleteFunc(names, func(name string) bool {
+		return !strings.HasPrefix(name, prefix)
+	})
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// lookup returns the value of a global, or nil.
+func (r *Repl) lookup(name string) Any {
+	return interpreter.globals.values[name]
+}
+
+// enclosingCallee returns the name called by the innermost unclosed
+// parenthesis in text, or "" if there is none.
+func enclosingCallee(text string) string {
+	depth := 0
+	for n := len(text) - 1; n >= 0; n-- {
+		switch text[n] {
+		case ')':
+			depth++
+		case '(':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			end := n
+			for end > 0 && text[end-1] == ' ' {
+				end--
+			}
+			start := end
+			for start > 0 {
+				c, size := utf8.DecodeLastRuneInString(text[:start])
+				if !isIdentifierRune(c) {
+					break
+				}
+				start -= size
+			}
+			return text[start:end]
+		}
+	}
+	return ""
+}
+
+func isIdentifierRune(c rune) bool {
+	return c == '_' || isXIDContinue(c)
+}
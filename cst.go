@@ -0,0 +1,223 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+	Concrete syntax tree
+
+	The AST drops everything that does not affect evaluation. For tools that
+	rewrite source, such as the formatter, the parser can additionally build
+	a concrete syntax tree: nodes named after the AST types they correspond to,
+	whose children are further nodes and the tokens they were parsed from, in
+	source order. Every token keeps the whitespace, comments and unscannable
+	text preceding it as trivia, and the final EOF token keeps the trailing
+	trivia of the file, so writing the tree back out reproduces the source
+	byte for byte.
+*/
+
+type TriviaKind int8
+
+const (
+	TRIVIA_WHITESPACE = iota
+	TRIVIA_LINE_COMMENT
+	TRIVIA_DOC_COMMENT
+	TRIVIA_BLOCK_COMMENT
+	// the #! interpreter line at the start of a script
+	TRIVIA_SHEBANG
+	// text the scanner reported as an error and skipped
+	TRIVIA_SKIPPED
+)
+
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+}
+
+type CSTElement interface {
+	Span() Span
+	writeText(sb *strings.Builder)
+}
+
+type CSTNode struct {
+	Kind     string
+	Children []CSTElement
+}
+
+type CSTToken struct {
+	Token   Token
+	Leading []Trivia
+}
+
+// ParseLossless parses source and returns its concrete syntax tree along
+// with the AST and the syntax errors found.
+func ParseLossless(source string) (*CSTNode, []Statement, []SyntaxError) {
+	return parseLossless(NewScanner(source))
+}
+
+func parseLossless(scanner *Scanner) (*CSTNode, []Statement, []SyntaxError) {
+	parser := NewParser(scanner.ScanTokens())
+	parser.cst = &cstBuilder{source: scanner.source}
+	stmts, errs := parser.Parse()
+	return parser.cst.finish(parser.peek()), stmts, errs
+}
+
+// Text returns the source text the node was parsed from, including the
+// trivia in front of its first token.
+func (n *CSTNode) Text() string {
+	var sb strings.Builder
+	n.writeText(&sb)
+	return sb.String()
+}
+
+func (n *CSTNode) writeText(sb *strings.Builder) {
+	for _, child := range n.Children {
+		child.writeText(sb)
+	}
+}
+
+// Span covers the tokens of the node, not including leading trivia.
+func (n *CSTNode) Span() Span {
+	var span Span
+	for _, child := range n.Children {
+		span = span.To(child.Span())
+	}
+	return span
+}
+
+func (t *CSTToken) writeText(sb *strings.Builder) {
+	for _, trivia := range t.Leading {
+		sb.WriteString(trivia.Text)
+	}
+	sb.WriteString(t.Token.Lexeme)
+}
+
+func (t *CSTToken) Span() Span {
+	return t.Token.Span()
+}
+
+// cstBuilder collects the tokens the parser consumes and groups them into
+// nodes. Productions call mark before parsing and wrap afterwards, which
+// replaces everything appended since the mark with a single node; this also
+// lets left-associative loops wrap an operand they have already parsed.
+type cstBuilder struct {
+	source   string
+	offset   int
+	children []CSTElement
+}
+
+func (b *cstBuilder) token(token Token) {
+	var leading []Trivia
+	text := b.source[b.offset:token.Start]
+	if b.offset == 0 && strings.HasPrefix(text, "#!") {
+		shebang := text[:lineLength(text)]
+		leading = append(leading, Trivia{Kind: TRIVIA_SHEBANG, Text: shebang})
+		text = text[len(shebang):]
+	}
+	b.children = append(b.children, &CSTToken{
+		Token:   token,
+		Leading: append(leading, splitTrivia(text)...),
+	})
+	b.offset = token.End
+}
+
+func (b *cstBuilder) mark() int {
+	return len(b.children)
+}
+
+func (b *cstBuilder) wrap(mark int, kind string) {
+	node := &CSTNode{Kind: kind, Children: append([]CSTElement(nil), b.children[mark:]...)}
+	b.children = append(b.children[:mark], node)
+}
+
+func (b *cstBuilder) finish(eof Token) *CSTNode {
+	b.token(eof)
+	b.wrap(0, "Program")
+	return b.children[0].(*CSTNode)
+}
+
+func (p *Parser) mark() int {
+	if p.cst == nil {
+		return 0
+	}
+	return p.cst.mark()
+}
+
+// node wraps the CST elements parsed since mark into a node named after the
+// type of the AST node, and returns the AST node.
+func node[T any](p *Parser, mark int, astNode T) T {
+	if p.cst != nil {
+		kind := reflect.TypeOf(astNode)
+		if kind.Kind() == reflect.Pointer {
+			kind = kind.Elem()
+		}
+		p.cst.wrap(mark, kind.Name())
+	}
+	return astNode
+}
+
+// splitTrivia classifies the text between two tokens.
+func splitTrivia(text string) []Trivia {
+	var trivia []Trivia
+	for len(text) > 0 {
+		kind, size := TRIVIA_SKIPPED, 0
+		switch {
+		case strings.HasPrefix(text, "///") && !strings.HasPrefix(text, "////"):
+			kind, size = TRIVIA_DOC_COMMENT, lineLength(text)
+		case strings.HasPrefix(text, "//"):
+			kind, size = TRIVIA_LINE_COMMENT, lineLength(text)
+		case strings.HasPrefix(text, "/*"):
+			kind, size = TRIVIA_BLOCK_COMMENT, blockCommentLength(text)
+		default:
+			for size < len(text) {
+				r, n := utf8.DecodeRuneInString(text[size:])
+				if !unicode.IsSpace(r) || r == byteOrderMark {
+					break
+				}
+				size += n
+			}
+			if size > 0 {
+				kind = TRIVIA_WHITESPACE
+			} else {
+				_, size = utf8.DecodeRuneInString(text)
+			}
+		}
+		if kind == TRIVIA_SKIPPED && len(trivia) > 0 && trivia[len(trivia)-1].Kind == TRIVIA_SKIPPED {
+			trivia[len(trivia)-1].Text += text[:size]
+		} else {
+			trivia = append(trivia, Trivia{Kind: TriviaKind(kind), Text: text[:size]})
+		}
+		text = text[size:]
+	}
+	return trivia
+}
+
+func lineLength(text string) int {
+	if n := strings.IndexByte(text, '\n'); n >= 0 {
+		return n
+	}
+	return len(text)
+}
+
+func blockCommentLength(text string) int {
+	depth := 0
+	for n := 0; n+1 < len(text); n++ {
+		switch text[n : n+2] {
+		case "/*":
+			depth++
+			n++
+		case "*/":
+			depth--
+			n++
+			if depth == 0 {
+				return n + 1
+			}
+		}
+	}
+	// unterminated, the scanner has reported it
+	return len(text)
+}
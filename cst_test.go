@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCST_RoundTrip(t *testing.T) {
+	sources := []string{
+		"",
+		"  // only a comment\n",
+		"/// doc\nfun f(a, b) {\n\treturn (a + b) * 2; /* why /* nested */ */\n}\r\nprint f(1, 2);  \n",
+		"match (x) {\n  1, 2 => print \"small\";\n  [a, _] if a > 0 => { print a; }\n  _ => print -1;\n}\n",
+		"for (k, v in {\"a\": 1}) print k;\nvar r = 0..<10;",
+		"#!/usr/bin/env gs\r\nprint 1;\n",
+		"#!/usr/bin/env gs",
+		// syntax and scanner errors keep their text too
+		"var = 1 @ 2;\nprint (;\n",
+		"\xef\xbb\xbfprint 1;\n/* unterminated",
+	}
+	files, _ := filepath.Glob("examples/*.gs")
+	for _, file := range files {
+		bytes, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, string(bytes))
+	}
+	for _, source := range sources {
+		tree, _, _ := ParseLossless(source)
+		if got := tree.Text(); got != source {
+			t.Errorf("round trip of %q produced %q", source, got)
+		}
+	}
+	hadError = false
+}
+
+func TestCST_Structure(t *testing.T) {
+	tree, _, _ := ParseLossless("print (1 + 2) * 3; // done\n")
+	stmt := tree.Children[0].(*CSTNode)
+	if stmt.Kind != "PrintStatement" || len(stmt.Children) != 3 {
+		t.Fatalf("got %s with %d children", stmt.Kind, len(stmt.Children))
+	}
+	product := stmt.Children[1].(*CSTNode)
+	grouping := product.Children[0].(*CSTNode)
+	if product.Kind != "BinaryExpression" || grouping.Kind != "GroupingExpression" {
+		t.Errorf("got %s(%s ...)", product.Kind, grouping.Kind)
+	}
+	if paren := grouping.Children[0].(*CSTToken); paren.Token.TokenType != TT_LEFT_PAREN || paren.Token.Column != 7 {
+		t.Errorf("opening paren %+v", paren.Token)
+	}
+	eof := tree.Children[len(tree.Children)-1].(*CSTToken)
+	if len(eof.Leading) != 3 || eof.Leading[1].Kind != TRIVIA_LINE_COMMENT || eof.Leading[1].Text != "// done" {
+		t.Errorf("trailing trivia %+v", eof.Leading)
+	}
+}
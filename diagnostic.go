@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Source is a named script text that diagnostics point into.
+type Source struct {
+	Name string
+	Text string
+}
+
+func NewSource(name string, text string) *Source {
+	return &Source{Name: name, Text: text}
+}
+
+// line returns the text of the 1-based line n without its line terminator.
+func (s *Source) line(n int) string {
+	lines := strings.SplitN(s.Text, "\n", n+1)
+	if n < 1 || n > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[n-1], "\r")
+}
+
+// Format renders a diagnostic as `name:line:col: message` followed by the
+// offending source line and a caret underline of the span on that line.
+func (s *Source) Format(span Span, message string) string {
+	if !span.IsValid() {
+		return fmt.Sprintf("%s: %s\n", s.Name, message)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s:%d:%d: %s\n", s.Name, span.Line, span.Column, message)
+
+	text := s.line(span.Line)
+	sb.WriteString("    ")
+	sb.WriteString(text)
+	sb.WriteString("\n    ")
+	// mirror tabs so the caret lines up however the terminal expands them
+	column := 1
+	for _, r := range text {
+		if column >= span.Column {
+			break
+		}
+		if r == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+		column++
+	}
+	width := 1
+	if span.End > span.Start && span.Start < len(s.Text) {
+		underlined := s.Text[span.Start:min(span.End, len(s.Text))]
+		if newline := strings.IndexByte(underlined, '\n'); newline >= 0 {
+			underlined = underlined[:newline]
+		}
+		width = max(1, utf8.RuneCountInString(strings.TrimRight(underlined, "\r")))
+	}
+	sb.WriteString(strings.Repeat("^", width))
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestSource_Format(t *testing.T) {
+	source := NewSource("a.gs", "var x;\n\tprint \"é\" + nope;\n")
+	tokens := NewScanner(source.Text).ScanTokens()
+	nope := tokens[6]
+	if nope.Lexeme != "nope" || nope.Line != 2 || nope.Column != 14 {
+		t.Fatalf("unexpected token %+v", nope)
+	}
+	want := "a.gs:2:14: Undefined.\n" +
+		"    \tprint \"é\" + nope;\n" +
+		"    \t            ^^^^\n"
+	if got := source.Format(nope.Span(), "Undefined."); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSpan_Nodes(t *testing.T) {
+	source := "print (1 + 2) * [3, 4];"
+	stmts, _ := NewParser(NewScanner(source).ScanTokens()).Parse()
+	span := stmts[0].Span()
+	if span.Start != 0 || span.End != len(source) || span.Column != 1 {
+		t.Errorf("statement span %+v", span)
+	}
+	expr := stmts[0].(PrintStatement).Expression
+	if got := source[expr.Span().Start:expr.Span().End]; got != "(1 + 2) * [3, 4]" {
+		t.Errorf("expression span covers %q", got)
+	}
+}
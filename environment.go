@@ -1,34 +1,51 @@
 package main
 
+import (
+	"maps"
+	"slices"
+)
+
+// Environment holds the variables of one scope. The global scope keeps its
+// variables by name, since scripts and the REPL can define globals at any
+// time. Local scopes keep theirs in slots, numbered by the Resolver in the
+// order of declaration, and are accessed by (depth, slot).
 type Environment struct {
 	enclosing *Environment
 	values    map[string]Any
+	slots     []Any
 }
 
 func NewEnvironment() *Environment {
 	return &Environment{enclosing: nil, values: make(map[string]Any)}
 }
 
-func NewEnvironmentWithEnclosing(enclosing *Environment) *Environment {
-	return &Environment{enclosing: enclosing, values: make(map[string]Any)}
+// NewEnvironmentWithEnclosing returns a local scope with room for size
+// variables.
+func NewEnvironmentWithEnclosing(enclosing *Environment, size int) *Environment {
+	return &Environment{enclosing: enclosing, slots: make([]Any, 0, size)}
 }
 
+// define declares a variable. In local scopes declarations happen in the
+// order the resolver numbered them, so the variable takes the next slot and
+// name is not needed.
 func (env *Environment) define(name string, value Any) {
-	env.values[name] = value
+	if env.values != nil {
+		env.values[name] = value
+		return
+	}
+	env.slots = append(env.slots, value)
 }
 
+// get returns the value of a global.
 func (env *Environment) get(name Token) Any {
 	if v, ok := env.values[name.Lexeme]; ok {
 		return v
 	}
-	if env.enclosing != nil {
-		return env.enclosing.get(name)
-	}
 	panic(NewRuntimeError(name, "Undefined variable '"+name.Lexeme+"'."))
 }
 
-func (env *Environment) getAt(distance int, name string) Any {
-	return env.ancestor(distance).values[name]
+func (env *Environment) getAt(distance int, slot int) Any {
+	return env.ancestor(distance).slots[slot]
 }
 
 func (env *Environment) ancestor(distance int) *Environment {
@@ -39,18 +56,20 @@ func (env *Environment) ancestor(distance int) *Environment {
 	return it
 }
 
+// assign sets the value of an existing global.
 func (env *Environment) assign(name Token, value Any) {
 	if _, ok := env.values[name.Lexeme]; ok {
 		env.values[name.Lexeme] = value
 		return
 	}
-	if env.enclosing != nil {
-		env.enclosing.assign(name, value)
-		return
-	}
 	panic(NewRuntimeError(name, "Undefined variable '"+name.Lexeme+"'."))
 }
 
-func (env *Environment) assignAt(distance int, name Token, value Any) {
-	env.ancestor(distance).values[name.Lexeme] = value
+func (env *Environment) assignAt(distance int, slot int, value Any) {
+	env.ancestor(distance).slots[slot] = value
+}
+
+// names returns the names of the globals, sorted.
+func (env *Environment) names() []string {
+	return slices.Sorted(maps.Keys(env.values))
 }
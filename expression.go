@@ -2,6 +2,7 @@ package main
 
 type Expression interface {
 	Accept(visitor ExpressionVisitor) Any
+	Span() Span
 }
 
 type ExpressionVisitor interface {
@@ -9,9 +10,13 @@ type ExpressionVisitor interface {
 	visitGroupingExpr(expr GroupingExpression) Any
 	visitLiteralExpr(expr LiteralExpression) Any
 	visitUnaryExpr(expr UnaryExpression) Any
-	visitVarExpr(expr VariableExpression) Any
-	visitAssignExpr(expr AssignExpression) Any
+	visitVarExpr(expr *VariableExpression) Any
+	visitAssignExpr(expr *AssignExpression) Any
 	visitCallExpr(expr CallExpression) Any
+	visitListExpr(expr ListExpression) Any
+	visitMapExpr(expr MapExpression) Any
+	visitRangeExpr(expr RangeExpression) Any
+	visitErrorExpr(expr ErrorExpression) Any
 }
 
 type BinaryExpression struct {
@@ -24,22 +29,37 @@ func (b BinaryExpression) Accept(visitor ExpressionVisitor) Any {
 	return visitor.visitBinaryExpr(b)
 }
 
+func (b BinaryExpression) Span() Span {
+	return expressionSpan(b.Left).To(expressionSpan(b.Right))
+}
+
 type GroupingExpression struct {
 	Expression Expression
+	LeftParen  Token
+	RightParen Token
 }
 
 func (b GroupingExpression) Accept(visitor ExpressionVisitor) Any {
 	return visitor.visitGroupingExpr(b)
 }
 
+func (b GroupingExpression) Span() Span {
+	return b.LeftParen.Span().To(b.RightParen.Span())
+}
+
 type LiteralExpression struct {
 	Value interface{}
+	Token Token
 }
 
 func (b LiteralExpression) Accept(visitor ExpressionVisitor) Any {
 	return visitor.visitLiteralExpr(b)
 }
 
+func (b LiteralExpression) Span() Span {
+	return b.Token.Span()
+}
+
 type UnaryExpression struct {
 	Operator Token
 	Right    Expression
@@ -49,23 +69,38 @@ func (b UnaryExpression) Accept(visitor ExpressionVisitor) Any {
 	return visitor.visitUnaryExpr(b)
 }
 
+func (b UnaryExpression) Span() Span {
+	return b.Operator.Span().To(expressionSpan(b.Right))
+}
+
+// VariableExpression and AssignExpression are handled by pointer so that
+// every occurrence of a variable is a distinct node for the resolver to
+// record the location of.
 type VariableExpression struct {
 	Name Token
 }
 
-func (b VariableExpression) Accept(visitor ExpressionVisitor) Any {
+func (b *VariableExpression) Accept(visitor ExpressionVisitor) Any {
 	return visitor.visitVarExpr(b)
 }
 
+func (b *VariableExpression) Span() Span {
+	return b.Name.Span()
+}
+
 type AssignExpression struct {
 	Name  Token
 	Value Expression
 }
 
-func (b AssignExpression) Accept(visitor ExpressionVisitor) Any {
+func (b *AssignExpression) Accept(visitor ExpressionVisitor) Any {
 	return visitor.visitAssignExpr(b)
 }
 
+func (b *AssignExpression) Span() Span {
+	return b.Name.Span().To(expressionSpan(b.Value))
+}
+
 type CallExpression struct {
 	Callee    Expression
 	Paren     Token
@@ -75,3 +110,63 @@ type CallExpression struct {
 func (b CallExpression) Accept(visitor ExpressionVisitor) Any {
 	return visitor.visitCallExpr(b)
 }
+
+func (b CallExpression) Span() Span {
+	return expressionSpan(b.Callee).To(b.Paren.Span())
+}
+
+type ListExpression struct {
+	Bracket  Token
+	Elements []Expression
+	Closing  Token
+}
+
+func (b ListExpression) Accept(visitor ExpressionVisitor) Any {
+	return visitor.visitListExpr(b)
+}
+
+func (b ListExpression) Span() Span {
+	return b.Bracket.Span().To(b.Closing.Span())
+}
+
+type MapExpression struct {
+	Brace   Token
+	Keys    []Expression
+	Values  []Expression
+	Closing Token
+}
+
+func (b MapExpression) Accept(visitor ExpressionVisitor) Any {
+	return visitor.visitMapExpr(b)
+}
+
+func (b MapExpression) Span() Span {
+	return b.Brace.Span().To(b.Closing.Span())
+}
+
+type RangeExpression struct {
+	Start    Expression
+	Operator Token
+	End      Expression
+}
+
+func (b RangeExpression) Accept(visitor ExpressionVisitor) Any {
+	return visitor.visitRangeExpr(b)
+}
+
+func (b RangeExpression) Span() Span {
+	return expressionSpan(b.Start).To(expressionSpan(b.End))
+}
+
+// ErrorExpression stands in for an expression that failed to parse.
+type ErrorExpression struct {
+	Token Token
+}
+
+func (b ErrorExpression) Accept(visitor ExpressionVisitor) Any {
+	return visitor.visitErrorExpr(b)
+}
+
+func (b ErrorExpression) Span() Span {
+	return b.Token.Span()
+}
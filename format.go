@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+/*
+	Formatter
+
+	Format prints a script in canonical style: two-space indentation, one
+	statement per line, braces on the line of the construct they belong to,
+	single spaces around binary operators and after commas and colons, and
+	no spaces inside parentheses, brackets or map braces. Comments are kept
+	where they were, either at the end of a line or on a line of their own,
+	and a single blank line is kept wherever the source had one or more.
+
+	It works on the token stream of the concrete syntax tree, deciding the
+	whitespace between each pair of tokens from their types and the kind of
+	node they belong to, so no token or comment can be lost on the way.
+*/
+
+const indentWidth = 2
+
+// Format returns source in canonical style. Sources with errors are not
+// formatted; the ScanErrors and SyntaxErrors found are returned joined
+// instead, for the caller to report.
+func Format(source string) (string, error) {
+	var errs []error
+	scanner := NewScanner(source)
+	scanner.report = func(span Span, message string) {
+		errs = append(errs, ScanError{Span: span, Message: message})
+	}
+	tree, _, syntaxErrs := parseLossless(scanner)
+	for _, err := range syntaxErrs {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	f := &formatter{}
+	f.collect(tree)
+	return f.format(), nil
+}
+
+// formatToken is a token together with the kind of the node containing it.
+type formatToken struct {
+	*CSTToken
+	parent string
+}
+
+func (t formatToken) is(types ...TokenType) bool {
+	for _, tokenType := range types {
+		if t.Token.TokenType == tokenType {
+			return true
+		}
+	}
+	return false
+}
+
+// isBlockBrace reports whether the token is a brace delimiting statements
+// rather than a map literal or map pattern.
+func (t formatToken) isBlockBrace() bool {
+	if !t.is(TT_LEFT_BRACE, TT_RIGHT_BRACE) {
+		return false
+	}
+	switch t.parent {
+	case "BlockStatement", "FunctionStatement", "MatchStatement":
+		return true
+	}
+	return false
+}
+
+type formatter struct {
+	tokens []formatToken
+	sb     strings.Builder
+
+	indent int
+	// continued is set while a statement continues on a further line
+	continued bool
+	lineStart bool
+}
+
+func (f *formatter) collect(node *CSTNode) {
+	for _, child := range node.Children {
+		switch c := child.(type) {
+		case *CSTNode:
+			f.collect(c)
+		case *CSTToken:
+			f.tokens = append(f.tokens, formatToken{CSTToken: c, parent: node.Kind})
+		}
+	}
+}
+
+func (f *formatter) format() string {
+	f.lineStart = true
+	for n, token := range f.tokens {
+		var previous *formatToken
+		if n > 0 {
+			previous = &f.tokens[n-1]
+		}
+		newlines := f.comments(previous, token)
+
+		if token.is(TT_EOF) {
+			break
+		}
+		if token.isBlockBrace() && token.is(TT_RIGHT_BRACE) {
+			f.indent--
+		}
+		switch {
+		case previous == nil:
+			// a blank line between the leading comments and the code
+			if newlines > 1 && f.sb.Len() > 0 {
+				f.newline(false)
+			}
+		case f.breaksLine(*previous, token):
+			blank := newlines > 1 && !(previous.isBlockBrace() && previous.is(TT_LEFT_BRACE)) &&
+				!(token.isBlockBrace() && token.is(TT_RIGHT_BRACE))
+			if !f.lineStart {
+				f.newline(false)
+			}
+			if blank {
+				f.newline(false)
+			}
+			f.continued = false
+		case f.lineStart:
+			// a line comment ended the line in the middle of a statement
+			f.continued = true
+		case f.spaced(*previous, token):
+			f.sb.WriteString(" ")
+		}
+		f.write(token.Token.Lexeme)
+		if token.isBlockBrace() && token.is(TT_LEFT_BRACE) {
+			f.indent++
+		}
+	}
+	if f.sb.Len() > 0 && !f.lineStart {
+		f.newline(false)
+	}
+	return f.sb.String()
+}
+
+// comments writes the comments in front of token and returns the number of
+// line breaks in the source between the last of them, or the previous
+// token, and token.
+func (f *formatter) comments(previous *formatToken, token formatToken) int {
+	newlines := 0
+	for _, trivia := range token.Leading {
+		switch trivia.Kind {
+		case TRIVIA_WHITESPACE:
+			newlines += strings.Count(trivia.Text, "\n")
+			continue
+		case TRIVIA_SKIPPED:
+			continue
+		}
+		text := strings.TrimRight(trivia.Text, " \t\r")
+		if previous != nil && newlines == 0 && !f.lineStart {
+			// trailing comment
+			f.sb.WriteString(" ")
+			f.write(text)
+		} else {
+			if !f.lineStart {
+				f.newline(false)
+			}
+			afterOpenBrace := previous != nil && previous.isBlockBrace() && previous.is(TT_LEFT_BRACE)
+			if newlines > 1 && f.sb.Len() > 0 && !afterOpenBrace {
+				f.newline(false)
+			}
+			f.continued = false
+			f.write(text)
+		}
+		if trivia.Kind != TRIVIA_BLOCK_COMMENT {
+			f.newline(false)
+		}
+		newlines = 0
+	}
+	return newlines
+}
+
+// breaksLine reports whether the structure of the code puts token on a new
+// line after previous.
+func (f *formatter) breaksLine(previous formatToken, token formatToken) bool {
+	if previous.is(TT_SEMICOLON) {
+		return true
+	}
+	if previous.isBlockBrace() && previous.is(TT_LEFT_BRACE) {
+		// empty blocks stay as {}
+		return !(token.isBlockBrace() && token.is(TT_RIGHT_BRACE))
+	}
+	if token.isBlockBrace() && token.is(TT_RIGHT_BRACE) {
+		return true
+	}
+	if previous.isBlockBrace() && previous.is(TT_RIGHT_BRACE) {
+		return !token.is(TT_ELSE, TT_SEMICOLON, TT_COMMA, TT_RIGHT_PAREN)
+	}
+	return false
+}
+
+// spaced reports whether a space separates two tokens on the same line.
+func (f *formatter) spaced(previous formatToken, token formatToken) bool {
+	if token.is(TT_COMMA, TT_SEMICOLON, TT_COLON, TT_RIGHT_PAREN, TT_RIGHT_BRACKET) {
+		return false
+	}
+	if previous.is(TT_LEFT_PAREN, TT_LEFT_BRACKET) {
+		return false
+	}
+	if token.is(TT_DOT_DOT, TT_DOT_DOT_LESS) || previous.is(TT_DOT_DOT, TT_DOT_DOT_LESS) {
+		return false
+	}
+	if previous.is(TT_MINUS, TT_BANG) && (previous.parent == "UnaryExpression" || previous.parent == "LiteralPattern") {
+		return false
+	}
+	if token.is(TT_LEFT_PAREN) && (token.parent == "CallExpression" || token.parent == "FunctionStatement") {
+		return false
+	}
+	if previous.is(TT_LEFT_BRACE) && (!previous.isBlockBrace() || token.is(TT_RIGHT_BRACE)) {
+		return false
+	}
+	if token.is(TT_RIGHT_BRACE) && !token.isBlockBrace() {
+		return false
+	}
+	return true
+}
+
+func (f *formatter) write(text string) {
+	if f.lineStart {
+		depth := f.indent
+		if f.continued {
+			depth++
+		}
+		f.sb.WriteString(strings.Repeat(" ", max(depth, 0)*indentWidth))
+		f.lineStart = false
+	}
+	f.sb.WriteString(text)
+}
+
+func (f *formatter) newline(blank bool) {
+	f.sb.WriteString("\n")
+	if blank {
+		f.sb.WriteString("\n")
+	}
+	f.lineStart = true
+}
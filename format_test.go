@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// TestFormat_Golden formats the examples and testdata/fmt/*.gs, comparing
+// the output with testdata/fmt/<name>.golden.
+func TestFormat_Golden(t *testing.T) {
+	examples, _ := filepath.Glob("examples/*.gs")
+	inputs, _ := filepath.Glob("testdata/fmt/*.gs")
+	for _, file := range append(examples, inputs...) {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Format(string(source))
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+		golden := filepath.Join("testdata", "fmt", strings.TrimSuffix(filepath.Base(file), ".gs")+".golden")
+		if *update {
+			if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != string(want) {
+			t.Errorf("%s: formatted output differs from %s:\n%s", file, golden, got)
+		}
+		again, _ := Format(got)
+		if again != got {
+			t.Errorf("%s: formatting is not idempotent:\n%s", file, again)
+		}
+	}
+}
+
+func TestFormat_SyntaxError(t *testing.T) {
+	if _, err := Format("print (1;"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestFormat_ReturnsDiagnostics(t *testing.T) {
+	s := newSession(t)
+	_, err := Format("print 1;\nprint \x01 (2;")
+	var scanErr ScanError
+	var syntaxErr SyntaxError
+	if !errors.As(err, &scanErr) || scanErr.Span.Line != 2 || scanErr.Span.Column != 7 {
+		t.Errorf("got %v, want a ScanError at 2:7", err)
+	}
+	if !errors.As(err, &syntaxErr) || syntaxErr.Token.Lexeme != ";" {
+		t.Errorf("got %v, want a SyntaxError at ';'", err)
+	}
+	if hadError || s.errOut.Len() > 0 {
+		t.Errorf("Format reported %q", s.errOut.String())
+	}
+}
+
+func TestFormat_KeepsShebang(t *testing.T) {
+	got, err := Format("#!/usr/bin/env gs\n\nprint   1;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "#!/usr/bin/env gs\n\nprint 1;\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
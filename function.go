@@ -1,5 +1,20 @@
 package main
 
+// returnValue carries the value of a return statement up through the
+// enclosing statements. Wrapping it keeps `return nil;` distinguishable from
+// a statement that completed without returning.
+type returnValue struct {
+	value Any
+}
+
+// tailCall is what `return f(...)` produces instead of a returnValue when f
+// is a script function. The Function.Call that is returning runs it in its
+// own place, so that calls in tail position don't grow the Go stack.
+type tailCall struct {
+	function  Function
+	arguments []Any
+}
+
 type Function struct {
 	Declaration FunctionStatement
 	Closure     *Environment
@@ -14,11 +29,33 @@ func (f Function) Arity() int {
 }
 
 func (f Function) Call(interpreter *Interpreter, arguments []Any) Any {
-	localEnv := NewEnvironmentWithEnclosing(f.Closure)
-	for i, param := range f.Declaration.Params {
-		localEnv.define(param.Lexeme, arguments[i])
+	return f.call(interpreter, arguments, -1)
+}
+
+// call runs the function and the functions it tail calls. site is the index
+// of the call in interpreter.calls, or -1 if it is not traced, and is
+// renamed after each function the call continues in.
+func (f Function) call(interpreter *Interpreter, arguments []Any, site int) Any {
+	for {
+		localEnv := NewEnvironmentWithEnclosing(f.Closure, len(f.Declaration.Params)+localCount(f.Declaration.Body))
+		for i, param := range f.Declaration.Params {
+			localEnv.define(param.Lexeme, arguments[i])
+		}
+		if f.Declaration.Generator {
+			return NewGenerator(f, interpreter, localEnv)
+		}
+		switch ret := interpreter.executeBlock(f.Declaration.Body, localEnv).(type) {
+		case returnValue:
+			return ret.value
+		case tailCall:
+			f, arguments = ret.function, ret.arguments
+			if site >= 0 {
+				interpreter.calls[site].name = f.Declaration.Name.Lexeme
+			}
+		default:
+			return nil
+		}
 	}
-	return interpreter.executeBlock(f.Declaration.Body, localEnv)
 }
 
 func (f Function) String() string {
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"slices"
+)
+
+// errGeneratorClosed unwinds the body of a generator that was garbage
+// collected while suspended at a yield.
+var errGeneratorClosed = errors.New("generator closed")
+
+// Generator is the value returned by calling a function containing `yield`.
+// The function body does not run until the generator is first resumed; it
+// then runs up to the next yield and is suspended there.
+//
+// A generator is a callable taking no arguments: each call resumes it and
+// returns the next yielded value, or nil once the body has finished. This
+// makes generators usable anywhere the iterator protocol accepts an iterator
+// function, while for-in loops use next directly so that yielded nils do not
+// end the loop early. Resuming a generator from its own body is a runtime
+// error.
+type Generator struct {
+	name  string
+	state *generatorState
+}
+
+// generatorState is shared between the Generator and the goroutine running
+// its body. It is kept separate from Generator so that the goroutine does
+// not keep the Generator reachable.
+type generatorState struct {
+	interpreter *Interpreter
+	body        []Statement
+	env         *Environment
+
+	resume  chan struct{}
+	yield   chan generatorResult
+	stop    chan struct{}
+	started bool
+	running bool
+	done    bool
+}
+
+// resumable is implemented by the generators of both engines.
+type resumable interface {
+	next() (Any, bool)
+}
+
+type generatorResult struct {
+	value Any
+	done  bool
+	fault Any
+}
+
+func NewGenerator(f Function, interpreter *Interpreter, env *Environment) *Generator {
+	state := &generatorState{
+		interpreter: interpreter,
+		body:        f.Declaration.Body,
+		env:         env,
+		resume:      make(chan struct{}),
+		yield:       make(chan generatorResult),
+		stop:        make(chan struct{}),
+	}
+	g := &Generator{name: f.Declaration.Name.Lexeme, state: state}
+	runtime.AddCleanup(g, func(s *generatorState) {
+		if s.started && !s.done {
+			close(s.stop)
+		}
+	}, state)
+	return g
+}
+
+func (g *Generator) Arity() int {
+	return 0
+}
+
+func (g *Generator) Call(interpreter *Interpreter, arguments []Any) Any {
+	value, _ := g.next()
+	return value
+}
+
+func (g *Generator) String() string {
+	return "<generator " + g.name + ">"
+}
+
+// next resumes the generator and returns the value it yields. The boolean
+// is false once the body has finished.
+func (g *Generator) next() (Any, bool) {
+	s := g.state
+	if s.done {
+		return nil, false
+	}
+	if s.running {
+		panic(nativeError("Generator is already running."))
+	}
+	s.running = true
+	if !s.started {
+		s.started = true
+		go s.run()
+	} else {
+		s.resume <- struct{}{}
+	}
+	result := <-s.yield
+	s.running = false
+	if result.fault != nil {
+		s.done = true
+		panic(result.fault)
+	}
+	if result.done {
+		s.done = true
+		return nil, false
+	}
+	return result.value, true
+}
+
+func (s *generatorState) run() {
+	defer func() {
+		if e := recover(); e != nil {
+			if e != errGeneratorClosed {
+				s.yield <- generatorResult{fault: e}
+			}
+			return
+		}
+		s.yield <- generatorResult{done: true}
+	}()
+	// the body runs on its own copy of the interpreter so that its current
+	// environment survives while the caller carries on with its own; the
+	// copy reads its limits and context from the original
+	interpreter := *s.interpreter
+	interpreter.generator = s
+	interpreter.owner = s.interpreter.root()
+	interpreter.calls = slices.Clone(interpreter.calls)
+	interpreter.executeBlock(s.body, s.env)
+}
+
+// suspend hands value to whoever resumed the generator and blocks until it
+// is resumed again.
+func (s *generatorState) suspend(value Any) {
+	s.yield <- generatorResult{value: value}
+	select {
+	case <-s.resume:
+	case <-s.stop:
+		panic(errGeneratorClosed)
+	}
+}
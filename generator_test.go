@@ -0,0 +1,78 @@
+package main
+
+import "testing"
+
+func TestGenerator(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"suspend and resume", `
+fun naturals() {
+  var n = 0;
+  while (true) {
+    n = n + 1;
+    yield n;
+  }
+}
+var a = naturals();
+var b = naturals();
+print a();
+print a();
+print b();
+print a();`, "1.000000\n2.000000\n1.000000\n3.000000\n"},
+		{"exhaustion", `
+fun one() {
+  yield 1;
+}
+var g = one();
+print g();
+print g();
+print g();
+for (x in g) print x;`, "1.000000\nnil\nnil\n"},
+		{"yielded nil in for-in", `
+fun maybe() {
+  yield 1;
+  yield nil;
+  yield 3;
+}
+for (x in maybe()) print x;`, "1.000000\nnil\n3.000000\n"},
+		{"error in body", `
+fun broken() {
+  yield 1;
+  yield nil + 1;
+}
+var g = broken();
+print g();
+print g();`, "1.000000\n" +
+			"<test>:4:13: Runtime error: Operands must be a numbers or strings.\n" +
+			"      yield nil + 1;\n" +
+			"                ^\n"},
+		{"resumed by itself", `
+fun g() {
+  yield it();
+}
+var it = g();
+print it();`, "<test>:3:12: Runtime error: Generator is already running.\n" +
+			"      yield it();\n" +
+			"               ^\n"},
+		{"iterated by itself", `
+fun g() {
+  for (x in it) yield x;
+}
+var it = g();
+for (x in it) print x;`, "<test>:3:10: Runtime error: Generator is already running.\n" +
+			"      for (x in it) yield x;\n" +
+			"             ^^\n"},
+	}
+	saved := engine
+	defer func() { engine = saved }()
+	for _, engine = range []string{ENGINE_TREE, ENGINE_VM} {
+		for _, test := range tests {
+			if got := runOutput(t, test.source); got != test.want {
+				t.Errorf("%s: %s: got %q, want %q", engine, test.name, got, test.want)
+			}
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
-import "time"
+import (
+	"math"
+	"os"
+	"time"
+)
 
 type clockFn struct {
 }
@@ -16,3 +20,78 @@ func (fn clockFn) Call(interpreter *Interpreter, arguments []Any) Any {
 func (fn clockFn) String() string {
 	return "<native fn>"
 }
+
+// exitRequest unwinds the interpreter when a script calls exit.
+type exitRequest struct {
+	code int
+}
+
+type exitFn struct {
+}
+
+func (fn exitFn) Arity() int {
+	return 1
+}
+
+func (fn exitFn) Call(interpreter *Interpreter, arguments []Any) Any {
+	code, ok := arguments[0].(float64)
+	if !ok || code != math.Trunc(code) || code < 0 || code > 255 {
+		panic(nativeError("Exit code must be an integer between 0 and 255."))
+	}
+	panic(exitRequest{code: int(code)})
+}
+
+func (fn exitFn) String() string {
+	return "<native fn>"
+}
+
+// readFileFn returns the contents of a file. It needs fs.read.
+type readFileFn struct {
+}
+
+func (fn readFileFn) Arity() int {
+	return 1
+}
+
+func (fn readFileFn) Call(interpreter *Interpreter, arguments []Any) Any {
+	path, ok := arguments[0].(string)
+	if !ok {
+		panic(nativeError("Path must be a string."))
+	}
+	bytes, err := os.ReadFile(interpreter.require(PERM_FS_READ, path))
+	if err != nil {
+		panic(nativeError("Can't read file: " + err.Error() + "."))
+	}
+	interpreter.allocate(Token{}, len(bytes))
+	return string(bytes)
+}
+
+func (fn readFileFn) String() string {
+	return "<native fn>"
+}
+
+// envFn returns the value of an environment variable, or nil if it is not
+// set. It needs env.
+type envFn struct {
+}
+
+func (fn envFn) Arity() int {
+	return 1
+}
+
+func (fn envFn) Call(interpreter *Interpreter, arguments []Any) Any {
+	name, ok := arguments[0].(string)
+	if !ok {
+		panic(nativeError("Variable name must be a string."))
+	}
+	interpreter.require(PERM_ENV, name)
+	if value, ok := os.LookupEnv(name); ok {
+		interpreter.allocate(Token{}, len(value))
+		return value
+	}
+	return nil
+}
+
+func (fn envFn) String() string {
+	return "<native fn>"
+}
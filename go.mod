@@ -1,3 +1,7 @@
 module go-script
 
-go 1.17
+go 1.24.0
+
+require golang.org/x/term v0.40.0
+
+require golang.org/x/sys v0.41.0 // indirect
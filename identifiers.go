@@ -0,0 +1,56 @@
+package main
+
+import "unicode"
+
+// Identifiers follow the default identifier syntax of Unicode UAX #31: an
+// XID_Start character (or an underscore) followed by XID_Continue characters.
+// The unicode package only provides the categories these properties are
+// derived from, so they are assembled here.
+
+// notXID holds the characters that are in ID_Start or ID_Continue but are
+// removed from XID_Start and XID_Continue because they are not stable under
+// NFKC normalisation.
+var notXID = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x037a, Hi: 0x037a, Stride: 1},
+		{Lo: 0x309b, Hi: 0x309c, Stride: 1},
+		{Lo: 0xfc5e, Hi: 0xfc63, Stride: 1},
+		{Lo: 0xfdfa, Hi: 0xfdfb, Stride: 1},
+		{Lo: 0xfe70, Hi: 0xfe7e, Stride: 2},
+	},
+}
+
+// notXIDStart holds the characters that may continue but not start an
+// identifier under XID rules although ID_Start would allow them.
+var notXIDStart = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x0e33, Hi: 0x0e33, Stride: 1},
+		{Lo: 0x0eb3, Hi: 0x0eb3, Stride: 1},
+		{Lo: 0xff9e, Hi: 0xff9f, Stride: 1},
+	},
+}
+
+func isIDStart(r rune) bool {
+	if unicode.In(r, unicode.Pattern_Syntax, unicode.Pattern_White_Space) {
+		return false
+	}
+	return unicode.In(r, unicode.L, unicode.Nl, unicode.Other_ID_Start)
+}
+
+func isIDContinue(r rune) bool {
+	if isIDStart(r) {
+		return true
+	}
+	if unicode.In(r, unicode.Pattern_Syntax, unicode.Pattern_White_Space) {
+		return false
+	}
+	return unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue)
+}
+
+func isXIDStart(r rune) bool {
+	return isIDStart(r) && !unicode.In(r, notXID, notXIDStart)
+}
+
+func isXIDContinue(r rune) bool {
+	return isIDContinue(r) && !unicode.Is(notXID, r)
+}
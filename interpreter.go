@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"time"
 )
 
 /*
@@ -18,44 +21,189 @@ class RuntimeError extends RuntimeException {
 type RuntimeError struct {
 	token   Token
 	message string
+	// trace is the call chain shown below a stack overflow, innermost
+	// call first
+	trace []string
+	// cause is the Go error that stopped the program, if any
+	cause error
 }
 
 func NewRuntimeError(token Token, message string) RuntimeError {
 	return RuntimeError{token: token, message: message}
 }
 
+func (e RuntimeError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.token.Line, e.token.Column, e.message)
+}
+
+func (e RuntimeError) Unwrap() error {
+	return e.cause
+}
+
+// nativeError is raised by native functions, which have no token of their
+// own, and reported as a RuntimeError at the call.
+type nativeError string
+
+// atCall returns the error to raise for err, raised by a native function
+// called at token: nativeErrors become RuntimeErrors there, and
+// BudgetErrors without a token get it.
+func atCall(err any, token Token) any {
+	switch e := err.(type) {
+	case nativeError:
+		return NewRuntimeError(token, string(e))
+	case BudgetError:
+		if e.token.Line == 0 {
+			e.token = token
+		}
+		return e
+	}
+	return err
+}
+
+// location is where the resolver found a local variable: the number of
+// scopes out from the current one, and the slot in that scope.
+type location struct {
+	depth int
+	slot  int
+}
+
+// DEFAULT_MAX_DEPTH is the default limit on nested script function calls,
+// well below the depth at which the Go stack would overflow.
+const DEFAULT_MAX_DEPTH = 10000
+
+// callSite is a script function call in progress: the name of the function
+// and where it was called.
+type callSite struct {
+	name  string
+	paren Token
+}
+
 type Interpreter struct {
+	// MaxDepth is how deeply script functions can call each other before
+	// the call fails with a stack overflow
+	MaxDepth int
+	// MaxSteps, Deadline and MaxAllocation bound the work programs can do
+	// when set, see budget.go
+	MaxSteps      int
+	Deadline      time.Time
+	MaxAllocation int
+	// Permissions are checked by privileged native functions, see
+	// permissions.go
+	Permissions *Permissions
+
 	globals *Environment
 	env     *Environment
-	locals  map[Expression]int
+	// locals holds where the resolver found every variable and assignment
+	// expression that refers to a local, keyed by the node's pointer
+	locals map[Expression]location
+	// scriptLocals holds the entries of locals resolved outside of any
+	// function, which are used only while the code is first run
+	scriptLocals []Expression
+	// calls holds the script function calls in progress, innermost last
+	calls []callSite
+	used  *spent
+	// ctx is the context of the running program; generator copies use the
+	// one of their root
+	ctx context.Context
+
+	// generator is the generator whose body this interpreter is running,
+	// or nil outside of generators
+	generator *generatorState
+	// owner is the interpreter a generator's copy was made from, whose
+	// settings and context the copy reads so that changes to them reach
+	// it, or nil
+	owner *Interpreter
 }
 
 func NewInterpreter() *Interpreter {
 	globals := NewEnvironment()
 	globals.define("clock", clockFn{})
-	return &Interpreter{globals: globals, env: globals, locals: make(map[Expression]int)}
+	globals.define("exit", exitFn{})
+	globals.define("readFile", readFileFn{})
+	globals.define("env", envFn{})
+	return &Interpreter{MaxDepth: DEFAULT_MAX_DEPTH, globals: globals, env: globals, locals: make(map[Expression]location), used: &spent{}, ctx: context.Background(), Permissions: Sandboxed()}
 }
 
-func (i *Interpreter) Interpret(statements []Statement) {
-	defer func() {
-		if err := recover(); err != nil {
-			runtimeFault(err.(RuntimeError))
-		}
-	}()
+// Interpret runs a resolved program, reporting runtime errors. It returns
+// the error that stopped the program, a RuntimeError or a BudgetError, or
+// nil.
+func (i *Interpreter) Interpret(statements []Statement) error {
+	return i.InterpretContext(context.Background(), statements)
+}
+
+// InterpretContext is like Interpret, but stops the program at its next
+// call or loop iteration once ctx is done, returning a RuntimeError that
+// wraps ctx.Err(). Native functions implementing ContextCallable get ctx.
+func (i *Interpreter) InterpretContext(ctx context.Context, statements []Statement) (err error) {
+	defer i.withContext(ctx)()
+	defer i.recoverFault(&err)
 	for _, s := range statements {
 		i.execute(s)
 	}
+	return nil
+}
+
+// root returns the interpreter whose settings apply to i: i itself, or the
+// one a generator's copy was made from.
+func (i *Interpreter) root() *Interpreter {
+	if i.owner != nil {
+		return i.owner
+	}
+	return i
+}
+
+// withContext makes ctx the context of the running program, and returns a
+// function restoring the previous one.
+func (i *Interpreter) withContext(ctx context.Context) func() {
+	previous := i.ctx
+	i.ctx = ctx
+	return func() { i.ctx = previous }
+}
+
+// InterpretExpression evaluates a resolved expression, reporting runtime
+// errors like Interpret. It returns nil if evaluation fails.
+func (i *Interpreter) InterpretExpression(expr Expression) Any {
+	defer i.recoverFault(new(error))
+	return i.evaluate(expr)
+}
+
+// recoverFault reports the runtime error stopping a program, if any, and
+// stores it in err.
+func (i *Interpreter) recoverFault(err *error) {
+	if fault := recover(); fault != nil {
+		switch e := fault.(type) {
+		case RuntimeError:
+			runtimeFault(e)
+			*err = e
+		case BudgetError:
+			runtimeFault(NewRuntimeError(e.token, e.Limit.String()))
+			*err = e
+		case exitRequest:
+			exitCode = e.code
+		default:
+			panic(fault)
+		}
+	}
 }
 
 func (i *Interpreter) execute(statement Statement) Any {
 	return statement.Accept(i)
 }
 
-func (i *Interpreter) Resolve(expr Expression, depth int) Any {
-	i.locals[expr] = depth
+func (i *Interpreter) Resolve(expr Expression, depth int, slot int) Any {
+	i.locals[expr] = location{depth: depth, slot: slot}
 	return nil
 }
 
+// forgetScriptLocals drops the locals resolved outside of any function, so
+// that running input after input, as the REPL does, doesn't keep them all.
+func (i *Interpreter) forgetScriptLocals() {
+	for _, expr := range i.scriptLocals {
+		delete(i.locals, expr)
+	}
+	i.scriptLocals = nil
+}
+
 func (i *Interpreter) executeBlock(statements []Statement, environment *Environment) Any {
 	previous := i.env
 	defer func() {
@@ -106,6 +254,7 @@ func (i *Interpreter) visitBinaryExpr(expr BinaryExpression) Any {
 		vs1, ok1 := left.(string)
 		vs2, ok2 := right.(string)
 		if ok1 && ok2 {
+			i.allocate(expr.Operator, len(vs1)+len(vs2))
 			return vs1 + vs2
 		}
 		panic(RuntimeError{token: expr.Operator, message: "Operands must be a numbers or strings."})
@@ -133,22 +282,20 @@ func (i *Interpreter) visitUnaryExpr(expr UnaryExpression) Any {
 		i.checkNumberOperand(expr.Operator, right)
 		return -(right.(float64))
 	case TT_BANG:
-		return !i.isTruthy(expr)
+		return !i.isTruthy(right)
 	}
 	// should be unreachable
 	return nil
 }
 
-func (i *Interpreter) visitVarExpr(expr VariableExpression) Any {
-	return i.env.get(expr.Name)
+func (i *Interpreter) visitVarExpr(expr *VariableExpression) Any {
+	return i.lookUpVariable(expr.Name, expr)
 }
 
-func (i *Interpreter) visitAssignExpr(expr AssignExpression) Any {
+func (i *Interpreter) visitAssignExpr(expr *AssignExpression) Any {
 	value := i.evaluate(expr.Value)
-	//old way: i.env.assign(expr.Name, value)
-	distance, ok := i.locals[expr]
-	if ok {
-		i.env.assignAt(distance, expr.Name, value)
+	if local, ok := i.locals[expr]; ok {
+		i.env.assignAt(local.depth, local.slot, value)
 	} else {
 		i.globals.assign(expr.Name, value)
 	}
@@ -157,11 +304,66 @@ func (i *Interpreter) visitAssignExpr(expr AssignExpression) Any {
 }
 
 func (i *Interpreter) visitCallExpr(expr CallExpression) Any {
+	function, arguments := i.evaluateCall(expr)
+	if f, ok := function.(Function); ok {
+		return i.callFunction(f, arguments, expr.Paren)
+	}
+	return i.callNative(expr, function, arguments)
+}
+
+// callFunction calls a script function for the call at paren, tracing the
+// call and failing if it would exceed MaxDepth.
+func (i *Interpreter) callFunction(f Function, arguments []Any, paren Token) Any {
+	if len(i.calls) >= i.root().MaxDepth {
+		panic(i.stackOverflow(paren))
+	}
+	i.calls = append(i.calls, callSite{name: f.Declaration.Name.Lexeme, paren: paren})
+	defer func() { i.calls = i.calls[:len(i.calls)-1] }()
+	return f.call(i, arguments, len(i.calls)-1)
+}
+
+// stackOverflow returns the error for a call at paren that would exceed
+// MaxDepth, tracing the calls in progress.
+func (i *Interpreter) stackOverflow(paren Token) RuntimeError {
+	trace := make([]string, 0, len(i.calls)+1)
+	at := paren
+	for n := len(i.calls) - 1; n >= 0; n-- {
+		trace = append(trace, fmt.Sprintf("[line %d] in %s()", at.Line, i.calls[n].name))
+		at = i.calls[n].paren
+	}
+	trace = append(trace, fmt.Sprintf("[line %d] in script", at.Line))
+	return RuntimeError{token: paren, message: "Stack overflow.", trace: foldRepeats(trace)}
+}
+
+// foldRepeats replaces runs of identical lines in a trace by the line and
+// a count, so that the trace of runaway recursion stays short.
+func foldRepeats(trace []string) []string {
+	var folded []string
+	for n := 0; n < len(trace); {
+		run := 1
+		for n+run < len(trace) && trace[n+run] == trace[n] {
+			run++
+		}
+		folded = append(folded, trace[n])
+		if run > 2 {
+			folded = append(folded, fmt.Sprintf("[previous line repeated %d more times]", run-1))
+		} else if run == 2 {
+			folded = append(folded, trace[n])
+		}
+		n += run
+	}
+	return folded
+}
+
+// evaluateCall evaluates the callee and arguments of a call and checks that
+// they can be called.
+func (i *Interpreter) evaluateCall(expr CallExpression) (Callable, []Any) {
 	callee := i.evaluate(expr.Callee)
 	var arguments []Any
 	for _, arg := range expr.Arguments {
 		arguments = append(arguments, i.evaluate(arg))
 	}
+	i.step(expr.Paren)
 	function, ok := callee.(Callable)
 	if !ok {
 		panic(NewRuntimeError(expr.Paren, "Can only call functions."))
@@ -169,7 +371,42 @@ func (i *Interpreter) visitCallExpr(expr CallExpression) Any {
 	if len(arguments) != function.Arity() {
 		panic(NewRuntimeError(expr.Paren, fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), len(arguments))))
 	}
-	return function.Call(i, arguments)
+	return function, arguments
+}
+
+func (i *Interpreter) callNative(expr CallExpression, function Callable, arguments []Any) Any {
+	defer func() {
+		if err := recover(); err != nil {
+			panic(atCall(err, expr.Paren))
+		}
+	}()
+	return i.invoke(function, arguments)
+}
+
+func (i *Interpreter) visitListExpr(expr ListExpression) Any {
+	elements := make([]Any, 0, len(expr.Elements))
+	for _, element := range expr.Elements {
+		elements = append(elements, i.evaluate(element))
+	}
+	i.allocate(expr.Bracket, len(elements)*ELEMENT_SIZE)
+	return NewList(elements)
+}
+
+func (i *Interpreter) visitMapExpr(expr MapExpression) Any {
+	dict := NewMap()
+	for n := range expr.Keys {
+		key := i.evaluate(expr.Keys[n])
+		if !isHashable(key) {
+			panic(NewRuntimeError(expr.Brace, "Map key must be a number, string or boolean."))
+		}
+		dict.Set(key, i.evaluate(expr.Values[n]))
+	}
+	i.allocate(expr.Brace, len(expr.Keys)*ENTRY_SIZE)
+	return dict
+}
+
+func (i *Interpreter) visitErrorExpr(expr ErrorExpression) Any {
+	panic(NewRuntimeError(expr.Token, "Can't evaluate code with syntax errors."))
 }
 
 /*
@@ -182,7 +419,7 @@ func (i *Interpreter) visitExprStmt(stmt ExpressionStatement) Any {
 
 func (i *Interpreter) visitPrintStmt(stmt PrintStatement) Any {
 	value := i.evaluate(stmt.Expression)
-	fmt.Printf("%s\n", i.stringify(value))
+	fmt.Fprintf(stdout, "%s\n", i.stringify(value))
 	return nil
 }
 
@@ -196,21 +433,24 @@ func (i *Interpreter) visitVarStmt(stmt VarStatement) Any {
 }
 
 func (i *Interpreter) visitBlockStmt(stmt BlockStatement) Any {
-	return i.executeBlock(stmt.Statements, NewEnvironmentWithEnclosing(i.env))
+	return i.executeBlock(stmt.Statements, NewEnvironmentWithEnclosing(i.env, localCount(stmt.Statements)))
 }
 
 func (i *Interpreter) visitIfStmt(stmt IfStatement) Any {
 	if i.isTruthy(i.evaluate(stmt.Condition)) {
-		i.execute(stmt.ThenBlock)
+		return i.execute(stmt.ThenBlock)
 	} else if stmt.ElseBlock != nil {
-		i.execute(stmt.ElseBlock)
+		return i.execute(stmt.ElseBlock)
 	}
 	return nil
 }
 
 func (i *Interpreter) visitWhileStmt(stmt WhileStatement) Any {
 	for i.isTruthy(i.evaluate(stmt.Condition)) {
-		i.execute(stmt.Body)
+		if ret := i.execute(stmt.Body); ret != nil {
+			return ret
+		}
+		i.step(stmt.Keyword)
 	}
 	return nil
 }
@@ -222,16 +462,72 @@ func (i *Interpreter) visitFunctionStmt(stmt FunctionStatement) Any {
 }
 
 func (i *Interpreter) visitReturnStmt(stmt ReturnStatement) Any {
+	if call, ok := stmt.Value.(CallExpression); ok {
+		function, arguments := i.evaluateCall(call)
+		if f, ok := function.(Function); ok {
+			return tailCall{function: f, arguments: arguments}
+		}
+		return returnValue{value: i.callNative(call, function, arguments)}
+	}
 	var value Any = nil
 	if stmt.Value != nil {
 		value = i.evaluate(stmt.Value)
 	}
-	return value
+	return returnValue{value: value}
+}
+
+func (i *Interpreter) visitMatchStmt(stmt MatchStatement) Any {
+	subject := i.evaluate(stmt.Subject)
+	for _, arm := range stmt.Arms {
+		env := NewEnvironmentWithEnclosing(i.env, 0)
+		if i.matchArm(arm, subject, env) {
+			return i.executeBlock([]Statement{arm.Body}, env)
+		}
+	}
+	return nil
+}
+
+func (i *Interpreter) matchArm(arm MatchArm, subject Any, env *Environment) bool {
+	matcher := &patternMatcher{interpreter: i, bind: func(name Token, value Any) {
+		env.define(name.Lexeme, value)
+	}}
+	for _, pattern := range arm.Patterns {
+		if !matcher.match(pattern, subject) {
+			continue
+		}
+		if arm.Guard == nil {
+			return true
+		}
+		return i.isTruthy(i.evaluateIn(arm.Guard, env))
+	}
+	return false
+}
+
+func (i *Interpreter) visitYieldStmt(stmt YieldStatement) Any {
+	var value Any = nil
+	if stmt.Value != nil {
+		value = i.evaluate(stmt.Value)
+	}
+	i.generator.suspend(value)
+	return nil
+}
+
+func (i *Interpreter) visitErrorStmt(stmt ErrorStatement) Any {
+	panic(NewRuntimeError(stmt.From, "Can't execute code with syntax errors."))
 }
 
 /*
 	Helpers
 */
+func (i *Interpreter) evaluateIn(expr Expression, environment *Environment) Any {
+	previous := i.env
+	defer func() {
+		i.env = previous
+	}()
+	i.env = environment
+	return i.evaluate(expr)
+}
+
 func (i *Interpreter) evaluate(expr Expression) Any {
 	return expr.Accept(i)
 }
@@ -258,6 +554,21 @@ func (i *Interpreter) stringify(object Any) string {
 	if f, ok := object.(float64); ok {
 		return fmt.Sprintf("%f", f)
 	}
+	if b, ok := object.(bool); ok {
+		return strconv.FormatBool(b)
+	}
+	if l, ok := object.(*List); ok {
+		return i.stringifyList(l)
+	}
+	if m, ok := object.(*Map); ok {
+		return i.stringifyMap(m)
+	}
+	if r, ok := object.(*Range); ok {
+		if r.Inclusive {
+			return i.stringify(r.Start) + ".." + i.stringify(r.End)
+		}
+		return i.stringify(r.Start) + "..<" + i.stringify(r.End)
+	}
 	return fmt.Sprintf("%s", object)
 }
 
@@ -278,10 +589,20 @@ func (i *Interpreter) checkNumberOperands(operator Token, left Any, right Any) {
 }
 
 func (i *Interpreter) lookUpVariable(name Token, expr Expression) Any {
-	distance, ok := i.locals[expr]
-	if ok {
-		return i.env.getAt(distance, name.Lexeme)
-	} else {
-		return i.globals.get(name)
+	if local, ok := i.locals[expr]; ok {
+		return i.env.getAt(local.depth, local.slot)
+	}
+	return i.globals.get(name)
+}
+
+// localCount returns the number of variables declared directly in stmts.
+func localCount(stmts []Statement) int {
+	n := 0
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case VarStatement, FunctionStatement:
+			n++
+		}
 	}
+	return n
 }
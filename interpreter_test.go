@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// session is the global state a test runs scripts in: a fresh interpreter,
+// and buffers collecting what they print and report.
+type session struct {
+	out    strings.Builder
+	errOut strings.Builder
+}
+
+// newSession sets up a session, restoring the global state it replaces
+// when the test ends.
+func newSession(tb testing.TB) *session {
+	s := &session{}
+	savedStdout, savedStderr, savedInterpreter := stdout, stderr, interpreter
+	savedEngine, savedOptimize, savedSource := engine, optimize, currentSource
+	tb.Cleanup(func() {
+		stdout, stderr, interpreter = savedStdout, savedStderr, savedInterpreter
+		engine, optimize, currentSource = savedEngine, savedOptimize, savedSource
+		hadError, hadRuntimeError, exitCode = false, false, -1
+	})
+	stdout, stderr = &s.out, &s.errOut
+	interpreter = NewInterpreter()
+	return s
+}
+
+// runSession runs sources one after the other with the same interpreter,
+// like inputs to the REPL, and returns what they print.
+func runSession(t *testing.T, sources ...string) []string {
+	t.Helper()
+	s := newSession(t)
+	for _, source := range sources {
+		run("<test>", source)
+	}
+	if s.errOut.Len() > 0 {
+		t.Error(s.errOut.String())
+	}
+	return strings.Split(strings.TrimSuffix(s.out.String(), "\n"), "\n")
+}
+
+func TestInterpreter_ClosuresSeeTheirOwnScope(t *testing.T) {
+	source, err := os.ReadFile("examples/script.gs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := runSession(t, string(source))
+	if want := []string{"global", "global"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInterpreter_AssignsAnyValue(t *testing.T) {
+	got := runSession(t, `
+fun f() { return 1; }
+{
+  var a;
+  a = [1];
+  print a;
+  a = f();
+  print a;
+}`)
+	if want := []string{"[1.000000]", "1.000000"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// Variables at the same position in different inputs are different
+// occurrences and may resolve differently.
+func TestInterpreter_ResolvesEveryOccurrence(t *testing.T) {
+	got := runSession(t,
+		"fun f(){var x=1;{print x;}}",
+		"fun g(){var x=2; print x;}",
+		"f();",
+	)
+	if want := []string{"1.000000"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// Tail calls must not grow the Go stack: with it limited to 1MB, this
+// recursion overflows without them.
+func TestInterpreter_TailCallsRunInConstantStack(t *testing.T) {
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+	got := runSession(t, `
+fun count(n, acc) {
+  if (n == 0) return acc;
+  return count(n - 1, acc + 1);
+}
+print count(100000, 0);`)
+	if want := []string{"100000.000000"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInterpreter_StackOverflow(t *testing.T) {
+	source := `
+fun f(n) {
+  return 1 + f(n + 1);
+}
+fun g() { return 1 + f(0); }
+print g();`
+	want := `<test>:3:21: Runtime error: Stack overflow.
+      return 1 + f(n + 1);
+                        ^
+  [line 3] in f()
+  [previous line repeated 8 more times]
+  [line 5] in g()
+  [line 6] in script
+`
+	for _, name := range []string{ENGINE_TREE, ENGINE_VM} {
+		t.Run(name, func(t *testing.T) {
+			s := newSession(t)
+			engine = name
+			interpreter.MaxDepth = 10
+			run("<test>", source)
+			if s.errOut.String() != want {
+				t.Errorf("got\n%s\nwant\n%s", s.errOut.String(), want)
+			}
+
+			// the interpreter can run more code afterwards
+			s.errOut.Reset()
+			run("<test>", "fun h(n) { if (n > 0) h(n - 1); } h(9);")
+			if s.errOut.Len() > 0 {
+				t.Error(s.errOut.String())
+			}
+		})
+	}
+}
+
+// A tail call replaces its caller in the trace, as it does on the stack.
+func TestInterpreter_TailCallTrace(t *testing.T) {
+	source := `
+fun a(n) {
+  return b(n);
+}
+fun b(n) {
+  return 1 + a(n + 1);
+}
+a(0);`
+	want := `<test>:6:21: Runtime error: Stack overflow.
+      return 1 + a(n + 1);
+                        ^
+  [line 6] in b()
+  [previous line repeated 9 more times]
+  [line 8] in script
+`
+	for _, name := range []string{ENGINE_TREE, ENGINE_VM} {
+		s := newSession(t)
+		engine = name
+		interpreter.MaxDepth = 10
+		run("<test>", source)
+		if s.errOut.String() != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, s.errOut.String(), want)
+		}
+	}
+}
+
+// An iterator function is called like any other, so one that loops over
+// itself overflows the stack.
+func TestInterpreter_IteratorStackOverflow(t *testing.T) {
+	source := `
+fun it() {
+  for (x in it) {}
+  return nil;
+}
+for (x in it) {}`
+	want := `<test>:3:10: Runtime error: Stack overflow.
+      for (x in it) {}
+             ^^
+  [line 3] in it()
+  [previous line repeated 9 more times]
+  [line 6] in script
+`
+	for _, name := range []string{ENGINE_TREE, ENGINE_VM} {
+		t.Run(name, func(t *testing.T) {
+			s := newSession(t)
+			engine = name
+			interpreter.MaxDepth = 10
+			run("<test>", source)
+			if s.errOut.String() != want {
+				t.Errorf("got\n%s\nwant\n%s", s.errOut.String(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"iter"
+	"unicode/utf8"
+)
+
+/*
+	Iterator protocol
+
+	A for-in loop asks the interpreter to turn its subject into a sequence of
+	(key, value) pairs:
+
+	  list       index and element
+	  map        key and value, in insertion order
+	  string     rune index and a one-character string
+	  range      position and number
+	  generator  yield count and yielded value
+	  iterator   call count and result
+
+	`for (x in xs)` binds only the value, except for maps where it binds the
+	key. `for (k, v in xs)` binds both.
+
+	A user-defined iterator is any callable taking no arguments. The loop
+	calls it repeatedly and stops at the first call returning nil, so a
+	closure over some state is enough to make a script value iterable.
+
+	Host code can expose lazy sequences by returning an iter.Seq[Any] or an
+	iter.Seq2[Any, Any] from a native function; the loop consumes them
+	directly.
+*/
+
+// Range is the runtime value of `start..end` (inclusive) and `start..<end`
+// (exclusive). Ranges always count up in steps of one.
+type Range struct {
+	Start     float64
+	End       float64
+	Inclusive bool
+}
+
+func (r *Range) contains(n float64) bool {
+	if r.Inclusive {
+		return n <= r.End
+	}
+	return n < r.End
+}
+
+func (i *Interpreter) visitRangeExpr(expr RangeExpression) Any {
+	start := i.evaluate(expr.Start)
+	end := i.evaluate(expr.End)
+	i.checkNumberOperands(expr.Operator, start, end)
+	return &Range{
+		Start:     start.(float64),
+		End:       end.(float64),
+		Inclusive: expr.Operator.TokenType == TT_DOT_DOT,
+	}
+}
+
+func (i *Interpreter) visitForInStmt(stmt ForInStatement) Any {
+	subject := i.evaluate(stmt.Iterable)
+	pairs := len(stmt.Variables) == 2
+	var result Any = nil
+	for key, value := range i.iterate(stmt.In, subject, pairs) {
+		env := NewEnvironmentWithEnclosing(i.env, len(stmt.Variables))
+		if pairs {
+			env.define(stmt.Variables[0].Lexeme, key)
+			env.define(stmt.Variables[1].Lexeme, value)
+		} else {
+			env.define(stmt.Variables[0].Lexeme, value)
+		}
+		result = i.executeBlock([]Statement{stmt.Body}, env)
+		if result != nil {
+			break
+		}
+		i.step(stmt.Keyword)
+	}
+	return result
+}
+
+// iterate implements the iterator protocol for subject. When pairs is false
+// maps yield their key as the value so that single-variable loops see keys.
+func (i *Interpreter) iterate(token Token, subject Any, pairs bool) iter.Seq2[Any, Any] {
+	switch v := subject.(type) {
+	case *List:
+		return func(yield func(Any, Any) bool) {
+			for n, element := range v.Elements {
+				if !yield(float64(n), element) {
+					return
+				}
+			}
+		}
+	case *Map:
+		return func(yield func(Any, Any) bool) {
+			for _, key := range v.Keys() {
+				value, _ := v.Get(key)
+				if !pairs {
+					value = key
+				}
+				if !yield(key, value) {
+					return
+				}
+			}
+		}
+	case string:
+		if !utf8.ValidString(v) {
+			panic(NewRuntimeError(token, "Can't iterate over a string with invalid UTF-8."))
+		}
+		return func(yield func(Any, Any) bool) {
+			n := 0
+			for _, r := range v {
+				if !yield(float64(n), string(r)) {
+					return
+				}
+				n++
+			}
+		}
+	case *Range:
+		return func(yield func(Any, Any) bool) {
+			n := 0
+			for x := v.Start; v.contains(x); x++ {
+				if !yield(float64(n), x) {
+					return
+				}
+				n++
+			}
+		}
+	case iter.Seq[Any]:
+		return func(yield func(Any, Any) bool) {
+			n := 0
+			for value := range v {
+				if !yield(float64(n), value) {
+					return
+				}
+				n++
+			}
+		}
+	case iter.Seq2[Any, Any]:
+		return v
+	case resumable:
+		return func(yield func(Any, Any) bool) {
+			for n := 0; ; n++ {
+				value, ok := i.resume(token, v)
+				if !ok || !yield(float64(n), value) {
+					return
+				}
+			}
+		}
+	case Callable:
+		if v.Arity() != 0 {
+			panic(NewRuntimeError(token, "Iterator functions can't take arguments."))
+		}
+		return func(yield func(Any, Any) bool) {
+			for n := 0; ; n++ {
+				var value Any
+				if f, ok := v.(Function); ok {
+					value = i.callFunction(f, nil, token)
+				} else {
+					value = v.Call(i, nil)
+				}
+				if value == nil || !yield(float64(n), value) {
+					return
+				}
+			}
+		}
+	}
+	panic(NewRuntimeError(token, "Can only iterate over lists, maps, strings, ranges and iterators."))
+}
+
+// resume resumes a generator for the for-in loop at token.
+func (i *Interpreter) resume(token Token, g resumable) (Any, bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			panic(atCall(err, token))
+		}
+	}()
+	return g.next()
+}
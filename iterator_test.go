@@ -0,0 +1,49 @@
+package main
+
+import (
+	"iter"
+	"testing"
+)
+
+func collect(seq iter.Seq2[Any, Any]) []Any {
+	var values []Any
+	for _, v := range seq {
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestIterate_HostSeq(t *testing.T) {
+	var seq iter.Seq[Any] = func(yield func(Any) bool) {
+		for _, s := range []string{"a", "b", "c"} {
+			if !yield(s) {
+				return
+			}
+		}
+	}
+	values := collect(NewInterpreter().iterate(Token{}, seq, false))
+	if len(values) != 3 || values[0] != "a" || values[2] != "c" {
+		t.Fail()
+	}
+}
+
+func TestIterate_MapKeys(t *testing.T) {
+	m := NewMap()
+	m.Set("b", 1.0)
+	m.Set("a", 2.0)
+	keys := collect(NewInterpreter().iterate(Token{}, m, false))
+	if len(keys) != 2 || keys[0] != "b" || keys[1] != "a" {
+		t.Fail()
+	}
+	values := collect(NewInterpreter().iterate(Token{}, m, true))
+	if values[0] != 1.0 || values[1] != 2.0 {
+		t.Fail()
+	}
+}
+
+func TestIterate_ExclusiveRange(t *testing.T) {
+	values := collect(NewInterpreter().iterate(Token{}, &Range{Start: 0, End: 3}, false))
+	if len(values) != 3 || values[2] != 2.0 {
+		t.Fail()
+	}
+}
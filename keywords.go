@@ -12,6 +12,8 @@ func init() {
 	keywords["for"] = TT_FOR
 	keywords["fun"] = TT_FUN
 	keywords["if"] = TT_IF
+	keywords["in"] = TT_IN
+	keywords["match"] = TT_MATCH
 	keywords["nil"] = TT_NIL
 	keywords["or"] = TT_OR
 	keywords["print"] = TT_PRINT
@@ -21,4 +23,5 @@ func init() {
 	keywords["true"] = TT_TRUE
 	keywords["var"] = TT_VAR
 	keywords["while"] = TT_WHILE
+	keywords["yield"] = TT_YIELD
 }
@@ -1,96 +1,487 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"time"
 )
 
+/*
+	Command line
+
+	`make` builds the command as gs, and `make install` copies it to
+	/usr/local/bin.
+
+	  gs [run] [-e code] [script | -] [args...]  run a script, inline code or standard input
+	  gs check [scripts...]                      parse and resolve without running
+	  gs repl                                    start an interactive prompt
+	  gs fmt [-w] [scripts...]                   format scripts
+	  gs ast [--format=sexpr|json] <script>      print the syntax tree
+	  gs tokens [--format=text|json] <script>    print the token stream
+	  gs test [files or directories...]          run scripts against their // expect: comments
+
+	run and test take --engine=tree, the default, to walk the syntax tree or
+	--engine=vm to compile it to bytecode for the virtual machine in vm.go,
+	and --optimize to rewrite the tree first (see optimizer.go). ast takes
+	--optimize to show the result. run takes --max-depth=n to change how
+	deeply functions can call each other before a stack overflow, 10000 by
+	default, and --max-steps=n, --timeout=duration and --max-alloc=bytes to
+	stop scripts that do too much work (see budget.go). Scripts run
+	sandboxed; run's --allow-read[=paths] and --allow-env[=names] let them
+	read files and environment variables (see permissions.go).
+
+	Without arguments gs starts the prompt. Arguments after the script are
+	available to it as the list `args`, and a script starting with a
+	`#!/usr/bin/env gs` line can be made executable and run directly.
+
+	A script that calls exit(code) exits with that code. Otherwise exit codes
+	follow sysexits.h:
+
+	  0   success
+	  1   a test failed
+	  64  usage error, or a syntax or resolution error in the script
+	  66  a script could not be read
+	  70  runtime error
+*/
+
+const (
+	EXIT_OK           = 0
+	EXIT_TEST_FAILURE = 1
+	EXIT_USAGE        = 64
+	EXIT_NO_INPUT     = 66
+	EXIT_SOFTWARE     = 70
+)
+
+const (
+	ENGINE_TREE = "tree"
+	ENGINE_VM   = "vm"
+)
+
+const usage = `Usage:
+  gs [run] [--engine=tree|vm] [--optimize] [--max-depth=n] [--max-steps=n]
+         [--timeout=duration] [--max-alloc=bytes] [--allow-read[=paths]]
+         [--allow-env[=names]] [-e code] [script | -] [args...]
+  gs check [scripts...]
+  gs repl
+  gs fmt [-w] [scripts...]
+  gs ast [--format=sexpr|json] [--optimize] <script>
+  gs tokens [--format=text|json] <script>
+  gs test [--engine=tree|vm] [--optimize] [files or directories...]
+`
+
 var hadError bool
 var hadRuntimeError bool
 
+// exitCode is the status the script passed to exit, or -1 if it did not.
+var exitCode = -1
+
+// stdout receives the output of print statements and stderr diagnostics.
+var stdout io.Writer = os.Stdout
+var stderr io.Writer = os.Stderr
+
 var interpreter *Interpreter
 
+// engine is how run executes programs, ENGINE_TREE or ENGINE_VM.
+var engine = ENGINE_TREE
+
+// optimize makes run optimize programs before executing them.
+var optimize = false
+
+// currentSource is the script being run, for diagnostics to quote from.
+var currentSource = NewSource("<stdin>", "")
+
 func check(e error) {
 	if e != nil {
 		panic(e)
 	}
 }
 
-func fault(line int, message string) {
-	report(line, "", message)
+func fault(span Span, message string) {
+	report(span, "", message)
 }
 
 func parseFault(token Token, message string) {
 	if token.TokenType == TT_EOF {
-		report(token.Line, " at end", message)
+		report(token.Span(), " at end", message)
 	} else {
-		report(token.Line, " at '"+token.Lexeme+"'", message)
+		report(token.Span(), " at '"+token.Lexeme+"'", message)
 	}
 }
 
-func report(line int, where string, message string) {
-	fmt.Printf("[line %d] %s: %s\n", line, where, message)
+func report(span Span, where string, message string) {
+	fmt.Fprint(stderr, currentSource.Format(span, "Error"+where+": "+message))
 	hadError = true
 }
 
+func warning(token Token, message string) {
+	fmt.Fprint(stderr, currentSource.Format(token.Span(), "Warning at '"+token.Lexeme+"': "+message))
+}
+
+// reportErrors reports the ScanErrors and SyntaxErrors joined in err.
+func reportErrors(err error) {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, err := range errs {
+		switch err := err.(type) {
+		case ScanError:
+			fault(err.Span, err.Message)
+		case SyntaxError:
+			parseFault(err.Token, err.Message)
+		default:
+			fmt.Fprintln(stderr, err)
+		}
+	}
+}
+
 func runtimeFault(err RuntimeError) {
-	fmt.Printf("[line %d] %s\n", err.token.Line, err.message)
+	fmt.Fprint(stderr, currentSource.Format(err.token.Span(), "Runtime error: "+err.message))
+	for _, line := range err.trace {
+		fmt.Fprintln(stderr, "  "+line)
+	}
 	hadRuntimeError = true
 }
 
-func run(source string) {
+// exitStatus returns the exit code for the errors reported so far.
+func exitStatus() int {
+	if exitCode >= 0 {
+		return exitCode
+	}
+	if hadError {
+		return EXIT_USAGE
+	}
+	if hadRuntimeError {
+		return EXIT_SOFTWARE
+	}
+	return EXIT_OK
+}
+
+// compile scans, parses and resolves source, returning nil if it has errors.
+func compile(name string, source string) []Statement {
+	currentSource = NewSource(name, source)
 	var scanner = NewScanner(source)
 	var tokens = scanner.ScanTokens()
 
 	var parser = NewParser(tokens)
-	stmts := parser.Parse()
+	stmts, errs := parser.Parse()
+	for _, err := range errs {
+		parseFault(err.Token, err.Message)
+	}
 
 	if hadError {
-		return
+		return nil
 	}
 
 	resolver := NewResolver(interpreter)
 	resolver.Resolve(stmts)
 
 	if hadError {
+		return nil
+	}
+	return stmts
+}
+
+func run(name string, source string) {
+	runContext(context.Background(), name, source)
+}
+
+// runContext runs source like run, stopping it once ctx is done.
+func runContext(ctx context.Context, name string, source string) {
+	stmts := compile(name, source)
+	if stmts == nil {
+		return
+	}
+	if optimize {
+		stmts = NewOptimizer(interpreter).Optimize(stmts)
+	}
+	if engine == ENGINE_VM {
+		if script := NewCompiler().Compile(stmts); script != nil {
+			NewVM(interpreter).InterpretContext(ctx, script)
+		}
 		return
 	}
+	interpreter.InterpretContext(ctx, stmts)
+}
 
-	interpreter.Interpret(stmts)
+// readSource reads a script, or standard input if name is "-", and returns
+// the name to use for it in diagnostics.
+func readSource(name string) (string, string, error) {
+	if name == "-" {
+		bytes, err := io.ReadAll(os.Stdin)
+		return "<stdin>", string(bytes), err
+	}
+	bytes, err := os.ReadFile(name)
+	return name, string(bytes), err
 }
 
-func runPrompt() {
-	reader := bufio.NewReader(os.Stdin)
-	for true {
-		fmt.Print("> ")
-		line, err := reader.ReadString('\n')
-		check(err)
-		run(line)
+// defineArgs exposes the script arguments to the program as `args`.
+func defineArgs(args []string) {
+	elements := make([]Any, 0, len(args))
+	for _, arg := range args {
+		elements = append(elements, arg)
+	}
+	interpreter.globals.define("args", NewList(elements))
+}
+
+// runRun implements `gs run [-e code] [script | -] [args...]`.
+func runRun(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	code := flags.String("e", "", "run `code` instead of a script")
+	flags.StringVar(&engine, "engine", engine, "`engine` to run with, tree or vm")
+	flags.BoolVar(&optimize, "optimize", optimize, "optimize the program before running it")
+	flags.IntVar(&interpreter.MaxDepth, "max-depth", interpreter.MaxDepth, "maximum `depth` of nested function calls")
+	flags.IntVar(&interpreter.MaxSteps, "max-steps", 0, "stop after `n` calls and loop iterations")
+	timeout := flags.Duration("timeout", 0, "stop after running for `duration`")
+	flags.IntVar(&interpreter.MaxAllocation, "max-alloc", 0, "stop after allocating about `bytes` of strings, lists and maps")
+	flags.Var(permissionFlag{PERM_FS_READ, interpreter.Permissions}, "allow-read", "allow reading files under the comma separated `paths`, or any file")
+	flags.Var(permissionFlag{PERM_ENV, interpreter.Permissions}, "allow-env", "allow reading the comma separated environment variables `names`, or any")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	if err := flags.Parse(args); err != nil || !validEngine() {
+		return EXIT_USAGE
+	}
+	if interpreter.MaxDepth < 1 {
+		fmt.Fprintln(os.Stderr, "--max-depth must be at least 1.")
+		return EXIT_USAGE
+	}
+	if *timeout > 0 {
+		interpreter.Deadline = time.Now().Add(*timeout)
+	}
+
+	var name, source string
+	scriptArgs := flags.Args()
+	if isFlagSet(flags, "e") {
+		name, source = "<arg>", *code
+	} else if len(scriptArgs) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return EXIT_USAGE
+	} else {
+		var err error
+		name, source, err = readSource(scriptArgs[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_NO_INPUT
+		}
+		scriptArgs = scriptArgs[1:]
+	}
+	defineArgs(scriptArgs)
+	run(name, source)
+	return exitStatus()
+}
+
+// runCheck implements `gs check [scripts...]`, which reports syntax and
+// resolution errors without running anything.
+func runCheck(args []string) int {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	status := EXIT_OK
+	for _, filename := range args {
+		name, source, err := readSource(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = max(status, EXIT_NO_INPUT)
+			continue
+		}
+		interpreter = NewInterpreter()
+		if compile(name, source) == nil {
+			status = max(status, EXIT_USAGE)
+		}
 		hadError = false
 	}
+	return status
 }
 
-func runScript(filename string) {
-	bytes, err := os.ReadFile(filename)
-	check(err)
-	run(string(bytes))
-	if hadError == true {
-		os.Exit(64)
+// runFmt implements `gs fmt [-w] [files...]`, formatting standard input
+// when no files are given.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+	if flags.NArg() == 0 {
+		name, source, err := readSource("-")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_NO_INPUT
+		}
+		currentSource = NewSource(name, source)
+		formatted, err := Format(source)
+		if err != nil {
+			reportErrors(err)
+			return EXIT_USAGE
+		}
+		fmt.Print(formatted)
+		return EXIT_OK
 	}
-	if hadRuntimeError == true {
-		os.Exit(70)
+	status := EXIT_OK
+	for _, filename := range flags.Args() {
+		bytes, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = EXIT_NO_INPUT
+			continue
+		}
+		currentSource = NewSource(filename, string(bytes))
+		formatted, err := Format(string(bytes))
+		if err != nil {
+			reportErrors(err)
+			status = EXIT_USAGE
+			continue
+		}
+		if !*write {
+			fmt.Print(formatted)
+		} else if formatted != string(bytes) {
+			check(os.WriteFile(filename, []byte(formatted), 0644))
+		}
 	}
+	return status
 }
 
-func main() {
-	interpreter = NewInterpreter()
-	if len(os.Args) == 1 {
-		runPrompt()
-	} else if len(os.Args) == 2 {
-		runScript(os.Args[1])
+// runAst implements `gs ast [--format=sexpr|json] [--optimize] file`,
+// printing the syntax tree of a script. Trees with syntax errors are printed
+// with their error nodes after the diagnostics, unless optimizing, which
+// needs a valid program.
+func runAst(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	format := flags.String("format", "sexpr", "output format, sexpr or json")
+	optimized := flags.Bool("optimize", false, "print the tree after optimizing it")
+	files, err := parseFlags(flags, args)
+	if err != nil {
+		return EXIT_USAGE
+	}
+	if len(files) != 1 || (*format != "sexpr" && *format != "json") {
+		fmt.Fprintln(os.Stderr, "Usage: gs ast [--format=sexpr|json] [--optimize] <script>")
+		return EXIT_USAGE
+	}
+	name, source, err := readSource(files[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_NO_INPUT
+	}
+	var stmts []Statement
+	if *optimized {
+		if stmts = compile(name, source); stmts == nil {
+			return exitStatus()
+		}
+		stmts = NewOptimizer(interpreter).Optimize(stmts)
 	} else {
-		println("Usage: lox <script>")
-		os.Exit(64)
+		var errs []SyntaxError
+		currentSource = NewSource(name, source)
+		stmts, errs = NewParser(NewScanner(source).ScanTokens()).Parse()
+		for _, err := range errs {
+			parseFault(err.Token, err.Message)
+		}
+	}
+
+	if *format == "json" {
+		output, err := (&AstJSONPrinter{}).Print(stmts)
+		check(err)
+		fmt.Print(output)
+	} else {
+		fmt.Print((&AstPrinter{}).PrintProgram(stmts))
+	}
+	return exitStatus()
+}
+
+// runTokens implements `gs tokens [--format=text|json] file`, printing the
+// token stream of a script. Scan errors are reported before the tokens.
+func runTokens(args []string) int {
+	flags := flag.NewFlagSet("tokens", flag.ContinueOnError)
+	format := flags.String("format", "text", "output format, text or json")
+	files, err := parseFlags(flags, args)
+	if err != nil {
+		return EXIT_USAGE
 	}
+	if len(files) != 1 || (*format != "text" && *format != "json") {
+		fmt.Fprintln(os.Stderr, "Usage: gs tokens [--format=text|json] <script>")
+		return EXIT_USAGE
+	}
+	name, source, err := readSource(files[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_NO_INPUT
+	}
+	currentSource = NewSource(name, source)
+	tokens := NewScanner(source).ScanTokens()
+
+	if *format == "json" {
+		output, err := tokensJSON(tokens)
+		check(err)
+		fmt.Print(output)
+	} else {
+		fmt.Print(tokensText(tokens))
+	}
+	return exitStatus()
+}
+
+// parseFlags parses flags that may appear before, between or after the
+// positional arguments, which it returns.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+func validEngine() bool {
+	if engine != ENGINE_TREE && engine != ENGINE_VM {
+		fmt.Fprintf(os.Stderr, "Unknown engine %q, expected tree or vm.\n", engine)
+		return false
+	}
+	return true
+}
+
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func runCommand(args []string) int {
+	if len(args) == 0 {
+		return runPrompt()
+	}
+	switch args[0] {
+	case "run":
+		return runRun(args[1:])
+	case "check":
+		return runCheck(args[1:])
+	case "repl":
+		return runPrompt()
+	case "fmt":
+		return runFmt(args[1:])
+	case "ast":
+		return runAst(args[1:])
+	case "tokens":
+		return runTokens(args[1:])
+	case "test":
+		return runTest(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return EXIT_OK
+	}
+	// gs script.gs and gs -e code are short for gs run
+	return runRun(args)
+}
+
+func main() {
+	interpreter = NewInterpreter()
+	defineArgs(nil)
+	os.Exit(runCommand(os.Args[1:]))
 }
@@ -0,0 +1,68 @@
+package main
+
+// patternMatcher tests a value against a Pattern, passing any bindings the
+// pattern introduces to bind.
+type patternMatcher struct {
+	interpreter *Interpreter
+	bind        func(name Token, value Any)
+	value       Any
+}
+
+func (m *patternMatcher) match(pattern Pattern, value Any) bool {
+	previous := m.value
+	defer func() {
+		m.value = previous
+	}()
+	m.value = value
+	return pattern.Accept(m).(bool)
+}
+
+func (m *patternMatcher) visitWildcardPattern(pattern WildcardPattern) Any {
+	return true
+}
+
+func (m *patternMatcher) visitLiteralPattern(pattern LiteralPattern) Any {
+	return m.interpreter.isEqual(m.value, pattern.Value)
+}
+
+func (m *patternMatcher) visitBindingPattern(pattern BindingPattern) Any {
+	m.bind(pattern.Name, m.value)
+	return true
+}
+
+func (m *patternMatcher) visitTypePattern(pattern TypePattern) Any {
+	if typeName(m.value) != pattern.TypeName.Lexeme {
+		return false
+	}
+	if pattern.Name.TokenType == TT_IDENTIFIER {
+		m.bind(pattern.Name, m.value)
+	}
+	return true
+}
+
+func (m *patternMatcher) visitListPattern(pattern ListPattern) Any {
+	list, ok := m.value.(*List)
+	if !ok || list.Len() != len(pattern.Elements) {
+		return false
+	}
+	for n, element := range pattern.Elements {
+		if !m.match(element, list.Elements[n]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *patternMatcher) visitMapPattern(pattern MapPattern) Any {
+	dict, ok := m.value.(*Map)
+	if !ok {
+		return false
+	}
+	for n, key := range pattern.Keys {
+		value, ok := dict.Get(key)
+		if !ok || !m.match(pattern.Values[n], value) {
+			return false
+		}
+	}
+	return true
+}
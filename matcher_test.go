@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// runOutput runs source in a new session and returns what it prints and
+// reports.
+func runOutput(t *testing.T, source string) string {
+	s := newSession(t)
+	run("<test>", source)
+	return s.out.String() + s.errOut.String()
+}
+
+func TestMatcher_Patterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    string
+	}{
+		{"1", "1", "matched\n"},
+		{"1", "2", "no match\n"},
+		{`"a"`, `"a"`, "matched\n"},
+		{"nil", "nil", "matched\n"},
+		{"true", "false", "no match\n"},
+		{"1, 2", "2", "matched\n"},
+		{"1, 2", "3", "no match\n"},
+		{"x", "3", "3.000000\n"},
+		{"[]", "[]", "matched\n"},
+		{"[1, x]", "[1, 2]", "2.000000\n"},
+		{"[1, x]", "[2, 2]", "no match\n"},
+		{"[x]", "[1, 2]", "no match\n"},
+		{"[[x], _]", "[[1], 2]", "1.000000\n"},
+		{"[x]", `"a"`, "no match\n"},
+		{`{"a": x}`, `{"a": 1, "b": 2}`, "1.000000\n"},
+		{`{"a": 1}`, `{"a": 2}`, "no match\n"},
+		{`{"a": x}`, `{"b": 1}`, "no match\n"},
+		{`{"a": x}`, "[1]", "no match\n"},
+		{"x: number", "1", "1.000000\n"},
+		{"x: number", `"1"`, "no match\n"},
+		{"x: string", `"s"`, "s\n"},
+		{"_: list", "[]", "matched\n"},
+		{"_: map", "{}", "matched\n"},
+		{"_: bool", "nil", "no match\n"},
+		{"x if x > 1", "2", "2.000000\n"},
+		{"x if x > 1", "1", "no match\n"},
+		{"[x, y] if x == y", "[1, 1]", "1.000000\n"},
+		{"[x, y] if x == y", "[1, 2]", "no match\n"},
+	}
+	for _, test := range tests {
+		arm := `print "matched";`
+		if strings.Contains(test.pattern, "x") {
+			arm = `print x;`
+		}
+		source := "match (" + test.value + ") {\n" +
+			"  " + test.pattern + " => " + arm + "\n" +
+			"  _ => print \"no match\";\n" +
+			"}"
+		if got := runOutput(t, source); got != test.want {
+			t.Errorf("%s against %s: got %q, want %q", test.pattern, test.value, got, test.want)
+		}
+	}
+}
+
+func TestResolver_MatchWithoutDefault(t *testing.T) {
+	tests := map[string]bool{
+		"match (1) { 1 => print 1; }":                  true,
+		"match (1) { x if x > 0 => print x; }":         true,
+		"match (1) { _: number => print 1; }":          true,
+		"match (1) { [x] => print x; }":                true,
+		"match (1) { 1 => print 1; _ => print 2; }":    false,
+		"match (1) { 1 => print 1; x => print x; }":    false,
+		"match (1) { x if x > 0 => print x; _ => {} }": false,
+	}
+	for source, warns := range tests {
+		out := runOutput(t, source)
+		if got := strings.Contains(out, "Warning at 'match': Match has no default arm."); got != warns {
+			t.Errorf("%q: warned %v, want %v\n%s", source, got, warns, out)
+		}
+	}
+}
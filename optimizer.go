@@ -0,0 +1,445 @@
+package main
+
+/*
+	Optimizer
+
+	`gs run --optimize` rewrites the resolved program before running it:
+
+	  folding     operations on literals are computed, so 2 * 3 + 1 becomes
+	              7 and !true becomes false
+	  branches    if (true) a; else b; becomes a, and while (false) and
+	              if (false) without an else disappear
+	  dead code   statements following a return in a block or function body
+	              are dropped
+	  inlining    calls to a function whose body is a single return of an
+	              expression of its parameters, like
+	              fun square(x) { return x * x; }, become that expression
+	              with the arguments substituted
+
+	Operations that would fail, such as 1 + "a", are left for the runtime
+	to report. To keep inlining invisible a function is only inlined if it
+	is declared once at the top level and never assigned to, at calls after
+	its declaration whose arguments are literals or variables.
+
+	`gs ast --optimize` prints the tree as it is after optimizing.
+*/
+
+type Optimizer struct {
+	interpreter *Interpreter
+	// inlining is set on the second pass, once the functions that can be
+	// inlined are known
+	inlining  bool
+	inlinable map[string]FunctionStatement
+	// declared counts the top-level declarations of every global and
+	// assigned records the globals assigned to anywhere
+	declared map[string]int
+	assigned map[string]bool
+}
+
+func NewOptimizer(interpreter *Interpreter) *Optimizer {
+	return &Optimizer{
+		interpreter: interpreter,
+		inlinable:   make(map[string]FunctionStatement),
+		declared:    make(map[string]int),
+		assigned:    make(map[string]bool),
+	}
+}
+
+// Optimize returns the optimized program. Its variables must have been
+// resolved by the interpreter the optimizer was created for.
+func (o *Optimizer) Optimize(statements []Statement) []Statement {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case VarStatement:
+			o.declared[s.Name.Lexeme]++
+		case FunctionStatement:
+			o.declared[s.Name.Lexeme]++
+		}
+	}
+	statements = o.optimizeList(statements, false)
+
+	for _, stmt := range statements {
+		if f, ok := stmt.(FunctionStatement); ok && o.canInline(f) {
+			o.inlinable[f.Name.Lexeme] = f
+		}
+	}
+	if len(o.inlinable) == 0 {
+		return statements
+	}
+	o.inlining = true
+	return o.optimizeList(statements, false)
+}
+
+func (o *Optimizer) optimizeExpr(expr Expression) Expression {
+	return expr.Accept(o).(Expression)
+}
+
+// optimizeStmt returns the optimized statement, or nil if it does nothing.
+func (o *Optimizer) optimizeStmt(stmt Statement) Statement {
+	if s, ok := stmt.Accept(o).(Statement); ok {
+		return s
+	}
+	return nil
+}
+
+// optimizeBody optimizes a statement that can't be left out, such as the
+// body of a loop.
+func (o *Optimizer) optimizeBody(stmt Statement) Statement {
+	if s := o.optimizeStmt(stmt); s != nil {
+		return s
+	}
+	span := stmt.Span()
+	return BlockStatement{LeftBrace: Token{Line: span.Line, Column: span.Column, Start: span.Start, End: span.Start}}
+}
+
+// optimizeList optimizes a list of statements, dropping the ones doing
+// nothing and, if afterReturn is set, the ones following a return.
+func (o *Optimizer) optimizeList(stmts []Statement, afterReturn bool) []Statement {
+	optimized := make([]Statement, 0, len(stmts))
+	for _, stmt := range stmts {
+		s := o.optimizeStmt(stmt)
+		if s == nil {
+			continue
+		}
+		optimized = append(optimized, s)
+		if _, ok := s.(ReturnStatement); ok && afterReturn {
+			break
+		}
+	}
+	return optimized
+}
+
+/*
+	Folding
+*/
+
+func (o *Optimizer) visitBinaryExpr(expr BinaryExpression) Any {
+	expr.Left = o.optimizeExpr(expr.Left)
+	expr.Right = o.optimizeExpr(expr.Right)
+	left, lok := expr.Left.(LiteralExpression)
+	right, rok := expr.Right.(LiteralExpression)
+	if !lok || !rok {
+		return expr
+	}
+	if value, ok := fold(expr.Operator.TokenType, left.Value, right.Value); ok {
+		return folded(expr.Span(), value)
+	}
+	return expr
+}
+
+// fold computes a binary operation on literal values, or returns false if
+// it fails at runtime.
+func fold(operator TokenType, left Any, right Any) (Any, bool) {
+	switch operator {
+	case TT_EQUAL_EQUAL:
+		return left == right, true
+	case TT_BANG_EQUAL:
+		return left != right, true
+	}
+	if l, ok := left.(string); ok && operator == TT_PLUS {
+		r, ok := right.(string)
+		return l + r, ok
+	}
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, false
+	}
+	switch operator {
+	case TT_PLUS:
+		return l + r, true
+	case TT_MINUS:
+		return l - r, true
+	case TT_STAR:
+		return l * r, true
+	case TT_SLASH:
+		return l / r, true
+	case TT_GREATER:
+		return l > r, true
+	case TT_GREATER_EQUAL:
+		return l >= r, true
+	case TT_LESS:
+		return l < r, true
+	case TT_LESS_EQUAL:
+		return l <= r, true
+	}
+	return nil, false
+}
+
+// folded returns the literal standing in for an expression at span.
+func folded(span Span, value Any) LiteralExpression {
+	token := Token{TokenType: TT_NUMBER, Lexeme: literalString(value), Literal: value,
+		Line: span.Line, Column: span.Column, Start: span.Start, End: span.End}
+	switch value.(type) {
+	case string:
+		token.TokenType = TT_STRING
+	case bool:
+		token.TokenType = TT_FALSE
+		if value == true {
+			token.TokenType = TT_TRUE
+		}
+		token.Literal = nil
+	}
+	return LiteralExpression{Value: value, Token: token}
+}
+
+func (o *Optimizer) visitGroupingExpr(expr GroupingExpression) Any {
+	expr.Expression = o.optimizeExpr(expr.Expression)
+	if literal, ok := expr.Expression.(LiteralExpression); ok {
+		return literal
+	}
+	return expr
+}
+
+func (o *Optimizer) visitLiteralExpr(expr LiteralExpression) Any {
+	return expr
+}
+
+func (o *Optimizer) visitUnaryExpr(expr UnaryExpression) Any {
+	expr.Right = o.optimizeExpr(expr.Right)
+	right, ok := expr.Right.(LiteralExpression)
+	if !ok {
+		return expr
+	}
+	switch expr.Operator.TokenType {
+	case TT_MINUS:
+		if n, ok := right.Value.(float64); ok {
+			return folded(expr.Span(), -n)
+		}
+	case TT_BANG:
+		return folded(expr.Span(), !o.interpreter.isTruthy(right.Value))
+	}
+	return expr
+}
+
+func (o *Optimizer) visitVarExpr(expr *VariableExpression) Any {
+	return expr
+}
+
+// visitAssignExpr updates the node in place, since the interpreter knows
+// the variable it assigns by the node's identity.
+func (o *Optimizer) visitAssignExpr(expr *AssignExpression) Any {
+	expr.Value = o.optimizeExpr(expr.Value)
+	if _, local := o.interpreter.locals[expr]; !local {
+		o.assigned[expr.Name.Lexeme] = true
+	}
+	return expr
+}
+
+func (o *Optimizer) visitCallExpr(expr CallExpression) Any {
+	expr.Callee = o.optimizeExpr(expr.Callee)
+	arguments := make([]Expression, len(expr.Arguments))
+	for n, arg := range expr.Arguments {
+		arguments[n] = o.optimizeExpr(arg)
+	}
+	expr.Arguments = arguments
+	if o.inlining {
+		if inlined := o.inline(expr); inlined != nil {
+			return inlined
+		}
+	}
+	return expr
+}
+
+func (o *Optimizer) visitListExpr(expr ListExpression) Any {
+	elements := make([]Expression, len(expr.Elements))
+	for n, element := range expr.Elements {
+		elements[n] = o.optimizeExpr(element)
+	}
+	expr.Elements = elements
+	return expr
+}
+
+func (o *Optimizer) visitMapExpr(expr MapExpression) Any {
+	keys := make([]Expression, len(expr.Keys))
+	values := make([]Expression, len(expr.Values))
+	for n := range expr.Keys {
+		keys[n] = o.optimizeExpr(expr.Keys[n])
+		values[n] = o.optimizeExpr(expr.Values[n])
+	}
+	expr.Keys, expr.Values = keys, values
+	return expr
+}
+
+func (o *Optimizer) visitRangeExpr(expr RangeExpression) Any {
+	expr.Start = o.optimizeExpr(expr.Start)
+	expr.End = o.optimizeExpr(expr.End)
+	return expr
+}
+
+func (o *Optimizer) visitErrorExpr(expr ErrorExpression) Any {
+	return expr
+}
+
+/*
+	Statements
+*/
+
+func (o *Optimizer) visitExprStmt(stmt ExpressionStatement) Any {
+	stmt.Expression = o.optimizeExpr(stmt.Expression)
+	return stmt
+}
+
+func (o *Optimizer) visitPrintStmt(stmt PrintStatement) Any {
+	stmt.Expression = o.optimizeExpr(stmt.Expression)
+	return stmt
+}
+
+func (o *Optimizer) visitVarStmt(stmt VarStatement) Any {
+	if stmt.Initializer != nil {
+		stmt.Initializer = o.optimizeExpr(stmt.Initializer)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitBlockStmt(stmt BlockStatement) Any {
+	stmt.Statements = o.optimizeList(stmt.Statements, true)
+	return stmt
+}
+
+func (o *Optimizer) visitIfStmt(stmt IfStatement) Any {
+	stmt.Condition = o.optimizeExpr(stmt.Condition)
+	if condition, ok := stmt.Condition.(LiteralExpression); ok {
+		if o.interpreter.isTruthy(condition.Value) {
+			return o.optimizeStmt(stmt.ThenBlock)
+		}
+		if stmt.ElseBlock == nil {
+			return nil
+		}
+		return o.optimizeStmt(stmt.ElseBlock)
+	}
+	stmt.ThenBlock = o.optimizeBody(stmt.ThenBlock)
+	if stmt.ElseBlock != nil {
+		stmt.ElseBlock = o.optimizeStmt(stmt.ElseBlock)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitWhileStmt(stmt WhileStatement) Any {
+	stmt.Condition = o.optimizeExpr(stmt.Condition)
+	if condition, ok := stmt.Condition.(LiteralExpression); ok && !o.interpreter.isTruthy(condition.Value) {
+		return nil
+	}
+	stmt.Body = o.optimizeBody(stmt.Body)
+	return stmt
+}
+
+func (o *Optimizer) visitForInStmt(stmt ForInStatement) Any {
+	stmt.Iterable = o.optimizeExpr(stmt.Iterable)
+	stmt.Body = o.optimizeBody(stmt.Body)
+	return stmt
+}
+
+func (o *Optimizer) visitFunctionStmt(stmt FunctionStatement) Any {
+	stmt.Body = o.optimizeList(stmt.Body, true)
+	return stmt
+}
+
+func (o *Optimizer) visitReturnStmt(stmt ReturnStatement) Any {
+	if stmt.Value != nil {
+		stmt.Value = o.optimizeExpr(stmt.Value)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitYieldStmt(stmt YieldStatement) Any {
+	if stmt.Value != nil {
+		stmt.Value = o.optimizeExpr(stmt.Value)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitMatchStmt(stmt MatchStatement) Any {
+	stmt.Subject = o.optimizeExpr(stmt.Subject)
+	arms := make([]MatchArm, len(stmt.Arms))
+	for n, arm := range stmt.Arms {
+		if arm.Guard != nil {
+			arm.Guard = o.optimizeExpr(arm.Guard)
+		}
+		arm.Body = o.optimizeBody(arm.Body)
+		arms[n] = arm
+	}
+	stmt.Arms = arms
+	return stmt
+}
+
+func (o *Optimizer) visitErrorStmt(stmt ErrorStatement) Any {
+	return stmt
+}
+
+/*
+	Inlining
+*/
+
+// canInline reports whether calls to a top-level function can be replaced
+// by its body.
+func (o *Optimizer) canInline(f FunctionStatement) bool {
+	if f.Generator || len(f.Body) != 1 || o.declared[f.Name.Lexeme] != 1 || o.assigned[f.Name.Lexeme] {
+		return false
+	}
+	ret, ok := f.Body[0].(ReturnStatement)
+	return ok && ret.Value != nil && o.onlyParameters(ret.Value)
+}
+
+// onlyParameters reports whether expr is made of literals and parameters
+// only, so that it means the same wherever it is substituted.
+func (o *Optimizer) onlyParameters(expr Expression) bool {
+	switch e := expr.(type) {
+	case LiteralExpression:
+		return true
+	case GroupingExpression:
+		return o.onlyParameters(e.Expression)
+	case UnaryExpression:
+		return o.onlyParameters(e.Right)
+	case BinaryExpression:
+		return o.onlyParameters(e.Left) && o.onlyParameters(e.Right)
+	case *VariableExpression:
+		local, ok := o.interpreter.locals[e]
+		return ok && local.depth == 0
+	}
+	return false
+}
+
+// inline returns the body of the function called with the arguments
+// substituted, or nil if the call can't be inlined.
+func (o *Optimizer) inline(call CallExpression) Expression {
+	callee, ok := call.Callee.(*VariableExpression)
+	if !ok {
+		return nil
+	}
+	if _, local := o.interpreter.locals[callee]; local {
+		return nil
+	}
+	f, ok := o.inlinable[callee.Name.Lexeme]
+	if !ok || len(call.Arguments) != len(f.Params) || call.Paren.Start < f.RightBrace.End {
+		return nil
+	}
+	for _, arg := range call.Arguments {
+		switch arg.(type) {
+		case LiteralExpression, *VariableExpression:
+		default:
+			return nil
+		}
+	}
+	body := f.Body[0].(ReturnStatement).Value
+	return o.optimizeExpr(o.substitute(body, call.Arguments))
+}
+
+// substitute copies expr, replacing parameters by the arguments.
+func (o *Optimizer) substitute(expr Expression, arguments []Expression) Expression {
+	switch e := expr.(type) {
+	case GroupingExpression:
+		e.Expression = o.substitute(e.Expression, arguments)
+		return e
+	case UnaryExpression:
+		e.Right = o.substitute(e.Right, arguments)
+		return e
+	case BinaryExpression:
+		e.Left = o.substitute(e.Left, arguments)
+		e.Right = o.substitute(e.Right, arguments)
+		return e
+	case *VariableExpression:
+		return arguments[o.interpreter.locals[e].slot]
+	}
+	return expr
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func optimized(t *testing.T, source string) string {
+	t.Helper()
+	newSession(t)
+	stmts, errs := NewParser(NewScanner(source).ScanTokens()).Parse()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	NewResolver(interpreter).Resolve(stmts)
+	return strings.TrimSpace((&AstPrinter{}).PrintProgram(NewOptimizer(interpreter).Optimize(stmts)))
+}
+
+func TestOptimizer(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"fold", `print 2 * 3 + 1;`, `(print 7)`},
+		{"fold strings", `print "a" + "b" == "ab";`, `(print true)`},
+		{"fold unary", `print -(1 + 1); print !nil;`, "(print -2)\n(print true)"},
+		{"keep failing", `print 1 + "a";`, `(print (+ 1 "a"))`},
+		{"keep variables", `var a = 1; print a + 1;`, "(var a 1)\n(print (+ a 1))"},
+		{"if true", `if (true) print 1; else print 2;`, `(print 1)`},
+		{"if false", `if (1 > 2) print 1; print 3;`, `(print 3)`},
+		{"while false", `while (false) print 1;`, ``},
+		{"dead code", `fun f(a) { print a; return; print 2; }`, `(fun f (a) (print a) (return))`},
+		{"inline", `fun sq(x) { return x * x; } var n = 2; print sq(n); print sq(3);`,
+			"(fun sq (x) (return (* x x)))\n(var n 2)\n(print (* n n))\n(print 9)"},
+		{"inline calls only", `fun sq(x) { return x * x; } var n = 2; print sq(n + 1);`,
+			"(fun sq (x) (return (* x x)))\n(var n 2)\n(print (call sq (+ n 1)))"},
+		{"inline parameters only", `var k = 2; fun f(x) { return x * k; } print f(1);`,
+			"(var k 2)\n(fun f (x) (return (* x k)))\n(print (call f 1))"},
+		{"inline unassigned", `fun f(x) { return x; } f = nil; print f(1);`,
+			"(fun f (x) (return x))\n(expr (= f nil))\n(print (call f 1))"},
+		{"inline after declaration", `fun g() { return f(1); } fun f(x) { return x; }`,
+			"(fun g () (return (call f 1)))\n(fun f (x) (return x))"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := optimized(t, test.source); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -2,67 +2,104 @@ package main
 
 import "fmt"
 
-var ParseError error = fmt.Errorf("an error occured during parsing")
+// SyntaxError is a single problem found while parsing, located at Token.
+type SyntaxError struct {
+	Token   Token
+	Message string
+}
+
+func (e SyntaxError) Error() string {
+	if e.Token.TokenType == TT_EOF {
+		return fmt.Sprintf("%d:%d at end: %s", e.Token.Line, e.Token.Column, e.Message)
+	}
+	return fmt.Sprintf("%d:%d at '%s': %s", e.Token.Line, e.Token.Column, e.Token.Lexeme, e.Message)
+}
 
 type Parser struct {
 	tokens  []Token
 	current int
+	errors  []SyntaxError
+
+	// panicMode is set from the first syntax error in a declaration until
+	// the parser has synchronized, and suppresses the cascade of follow-up
+	// errors the first one usually causes
+	panicMode bool
+	// cst builds the concrete syntax tree when parsing losslessly
+	cst *cstBuilder
+	// sawYield records whether the function body being parsed yields
+	sawYield bool
 }
 
 func NewParser(tokens []Token) *Parser {
 	return &Parser{tokens: tokens, current: 0}
 }
 
-func (p *Parser) Parse() []Statement {
-	defer func() {
-		recover()
-	}()
-
+// Parse parses the whole token stream. Declarations that contain syntax
+// errors are replaced by ErrorStatements covering their tokens, so the
+// returned program is complete whenever the returned error list is empty.
+func (p *Parser) Parse() ([]Statement, []SyntaxError) {
 	var statements []Statement
 	for !p.isAtEnd() {
 		statements = append(statements, p.declaration())
 	}
 
-	return statements
+	return statements, p.errors
 }
 
 func (p *Parser) declaration() Statement {
-	defer p.recover()
+	start := p.current
+	m := p.mark()
+	var stmt Statement
 	if p.match(TT_FUN) {
-		return p.function()
+		function := p.function()
+		function.Doc = function.Keyword.Doc
+		stmt = node(p, m, function)
+	} else if p.match(TT_VAR) {
+		stmt = node(p, m, p.varDeclaration())
+	} else {
+		stmt = p.statement()
 	}
-	if p.match(TT_VAR) {
-		return p.varDeclaration()
-	}
-	return p.statement()
-}
-
-func (p *Parser) recover() {
-	e := recover()
-	switch e {
-	case nil:
-		return
-	case ParseError:
-		p.synchronize()
-	default:
-		panic(e)
+	if p.panicMode {
+		p.synchronize(start)
+		p.panicMode = false
+		return node(p, m, ErrorStatement{From: p.tokens[start], To: p.previous()})
 	}
+	return stmt
 }
 
 func (p *Parser) statement() Statement {
+	m := p.mark()
 	if p.match(TT_IF) {
-		return p.ifStatement()
+		return node(p, m, p.ifStatement())
+	}
+	if p.match(TT_WHILE) {
+		return node(p, m, p.whileStatement())
+	}
+	if p.match(TT_FOR) {
+		return node(p, m, p.forInStatement())
 	}
 	if p.match(TT_RETURN) {
-		return p.returnStatement()
+		return node(p, m, p.returnStatement())
+	}
+	if p.match(TT_YIELD) {
+		return node(p, m, p.yieldStatement())
 	}
 	if p.match(TT_PRINT) {
-		return p.printStatement()
+		return node(p, m, p.printStatement())
+	}
+	if p.match(TT_MATCH) {
+		return node(p, m, p.matchStatement())
 	}
 	if p.match(TT_LEFT_BRACE) {
-		return BlockStatement{Statements: p.block()}
+		leftBrace := p.previous()
+		statements := p.block()
+		return node(p, m, BlockStatement{
+			LeftBrace:  leftBrace,
+			Statements: statements,
+			RightBrace: p.previous(),
+		})
 	}
-	return p.expressionStatement()
+	return node(p, m, p.expressionStatement())
 }
 
 func (p *Parser) returnStatement() Statement {
@@ -71,34 +108,55 @@ func (p *Parser) returnStatement() Statement {
 	if !p.check(TT_SEMICOLON) {
 		value = p.expression()
 	}
-	p.consume(TT_SEMICOLON, "Expect ';' after return value.")
+	semicolon := p.consume(TT_SEMICOLON, "Expect ';' after return value.")
 	return ReturnStatement{
-		Keyword: keyword,
-		Value:   value,
+		Keyword:   keyword,
+		Value:     value,
+		Semicolon: semicolon,
+	}
+}
+
+func (p *Parser) yieldStatement() Statement {
+	keyword := p.previous()
+	var value Expression = nil
+	if !p.check(TT_SEMICOLON) {
+		value = p.expression()
+	}
+	semicolon := p.consume(TT_SEMICOLON, "Expect ';' after yield value.")
+	p.sawYield = true
+	return YieldStatement{
+		Keyword:   keyword,
+		Value:     value,
+		Semicolon: semicolon,
 	}
 }
 
 func (p *Parser) varDeclaration() Statement {
+	keyword := p.previous()
 	var name Token = p.consume(TT_IDENTIFIER, "Expect variable name.")
 	var initializer Expression = nil
 	if p.match(TT_EQUAL) {
 		initializer = p.expression()
 	}
-	p.consume(TT_SEMICOLON, "Expect ';' after variable declaration")
+	semicolon := p.consume(TT_SEMICOLON, "Expect ';' after variable declaration")
 	return VarStatement{
+		Keyword:     keyword,
 		Name:        name,
 		Initializer: initializer,
+		Semicolon:   semicolon,
+		Doc:         keyword.Doc,
 	}
 }
 
 func (p *Parser) function() FunctionStatement {
+	keyword := p.previous()
 	fnName := p.consume(TT_IDENTIFIER, "Expect function name.")
 	p.consume(TT_LEFT_PAREN, "Expect '(' after function name.")
 	var parameters []Token
 	if !p.check(TT_RIGHT_PAREN) {
 		for true {
 			if len(parameters) >= 255 {
-				parseFault(p.peek(), "Can't have more than 255 parameters.")
+				p.report(p.peek(), "Can't have more than 255 parameters.")
 			}
 			parameters = append(parameters, p.consume(TT_IDENTIFIER, "Expect parameter name."))
 			if !p.match(TT_COMMA) {
@@ -108,27 +166,36 @@ func (p *Parser) function() FunctionStatement {
 	}
 	p.consume(TT_RIGHT_PAREN, "Expect ')' after parameters.")
 	p.consume(TT_LEFT_BRACE, "Expect '{' before function body.")
+	enclosing := p.sawYield
+	p.sawYield = false
 	body := p.block()
+	generator := p.sawYield
+	p.sawYield = enclosing
 	return FunctionStatement{
-		Name:   fnName,
-		Params: parameters,
-		Body:   body,
+		Keyword:    keyword,
+		Name:       fnName,
+		Params:     parameters,
+		Body:       body,
+		RightBrace: p.previous(),
+		Generator:  generator,
 	}
 }
 
 func (p *Parser) printStatement() Statement {
+	keyword := p.previous()
 	value := p.expression()
-	p.consume(TT_SEMICOLON, "Expect ';' after value.")
-	return PrintStatement{Expression: value}
+	semicolon := p.consume(TT_SEMICOLON, "Expect ';' after value.")
+	return PrintStatement{Keyword: keyword, Expression: value, Semicolon: semicolon}
 }
 
 func (p *Parser) expressionStatement() Statement {
 	expr := p.expression()
-	p.consume(TT_SEMICOLON, "Expect ';' after expression.")
-	return ExpressionStatement{Expression: expr}
+	semicolon := p.consume(TT_SEMICOLON, "Expect ';' after expression.")
+	return ExpressionStatement{Expression: expr, Semicolon: semicolon}
 }
 
 func (p *Parser) ifStatement() Statement {
+	keyword := p.previous()
 	p.consume(TT_LEFT_PAREN, "Expect '(' after 'if'.")
 	condition := p.expression()
 	p.consume(TT_RIGHT_PAREN, "Expect ')' after if condition.")
@@ -138,6 +205,7 @@ func (p *Parser) ifStatement() Statement {
 		elseBranch = p.statement()
 	}
 	return IfStatement{
+		Keyword:   keyword,
 		Condition: condition,
 		ThenBlock: thenBranch,
 		ElseBlock: elseBranch,
@@ -145,16 +213,167 @@ func (p *Parser) ifStatement() Statement {
 }
 
 func (p *Parser) whileStatement() Statement {
+	keyword := p.previous()
 	p.consume(TT_LEFT_PAREN, "Expect '(' after 'while'.")
 	condition := p.expression()
-	p.consume(TT_LEFT_PAREN, "Expect ')' after condition.")
+	p.consume(TT_RIGHT_PAREN, "Expect ')' after condition.")
 	body := p.statement()
 	return WhileStatement{
+		Keyword:   keyword,
 		Condition: condition,
 		Body:      body,
 	}
 }
 
+func (p *Parser) forInStatement() Statement {
+	keyword := p.previous()
+	p.consume(TT_LEFT_PAREN, "Expect '(' after 'for'.")
+	variables := []Token{p.consume(TT_IDENTIFIER, "Expect loop variable name.")}
+	if p.match(TT_COMMA) {
+		variables = append(variables, p.consume(TT_IDENTIFIER, "Expect loop variable name."))
+	}
+	in := p.consume(TT_IN, "Expect 'in' after loop variable.")
+	iterable := p.expression()
+	p.consume(TT_RIGHT_PAREN, "Expect ')' after for clause.")
+	body := p.statement()
+	return ForInStatement{
+		Keyword:   keyword,
+		Variables: variables,
+		In:        in,
+		Iterable:  iterable,
+		Body:      body,
+	}
+}
+
+func (p *Parser) matchStatement() Statement {
+	keyword := p.previous()
+	p.consume(TT_LEFT_PAREN, "Expect '(' after 'match'.")
+	subject := p.expression()
+	p.consume(TT_RIGHT_PAREN, "Expect ')' after match subject.")
+	p.consume(TT_LEFT_BRACE, "Expect '{' before match arms.")
+	var arms []MatchArm
+	for !p.check(TT_RIGHT_BRACE) && !p.isAtEnd() && !p.panicMode {
+		arms = append(arms, p.matchArm())
+	}
+	rightBrace := p.consume(TT_RIGHT_BRACE, "Expect '}' after match arms.")
+	return MatchStatement{
+		Keyword:    keyword,
+		Subject:    subject,
+		Arms:       arms,
+		RightBrace: rightBrace,
+	}
+}
+
+func (p *Parser) matchArm() MatchArm {
+	m := p.mark()
+	var patterns []Pattern
+	for true {
+		patterns = append(patterns, p.pattern())
+		if !p.match(TT_COMMA) {
+			break
+		}
+	}
+	var guard Expression = nil
+	if p.match(TT_IF) {
+		guard = p.expression()
+	}
+	arrow := p.consume(TT_ARROW, "Expect '=>' after match pattern.")
+	body := p.statement()
+	return node(p, m, MatchArm{
+		Patterns: patterns,
+		Guard:    guard,
+		Arrow:    arrow,
+		Body:     body,
+	})
+}
+
+func (p *Parser) pattern() Pattern {
+	m := p.mark()
+	if p.match(TT_UNDERSCORE, TT_IDENTIFIER) {
+		name := p.previous()
+		if p.match(TT_COLON) {
+			return node(p, m, TypePattern{Name: name, TypeName: p.patternType()})
+		}
+		if name.TokenType == TT_UNDERSCORE {
+			return node(p, m, WildcardPattern{Token: name})
+		}
+		return node(p, m, BindingPattern{Name: name})
+	}
+	if p.match(TT_LEFT_BRACKET) {
+		bracket := p.previous()
+		var elements []Pattern
+		if !p.check(TT_RIGHT_BRACKET) {
+			for true {
+				elements = append(elements, p.pattern())
+				if !p.match(TT_COMMA) {
+					break
+				}
+			}
+		}
+		closing := p.consume(TT_RIGHT_BRACKET, "Expect ']' after list pattern.")
+		return node(p, m, ListPattern{Bracket: bracket, Elements: elements, Closing: closing})
+	}
+	if p.match(TT_LEFT_BRACE) {
+		brace := p.previous()
+		var keys []Any
+		var values []Pattern
+		if !p.check(TT_RIGHT_BRACE) {
+			for true {
+				key := p.literalPattern()
+				if !isHashable(key.Value) {
+					p.report(key.Token, "Map key must be a number, string or boolean.")
+				}
+				p.consume(TT_COLON, "Expect ':' after map pattern key.")
+				keys = append(keys, key.Value)
+				values = append(values, p.pattern())
+				if !p.match(TT_COMMA) {
+					break
+				}
+			}
+		}
+		closing := p.consume(TT_RIGHT_BRACE, "Expect '}' after map pattern.")
+		return node(p, m, MapPattern{Brace: brace, Keys: keys, Values: values, Closing: closing})
+	}
+	return p.literalPattern()
+}
+
+func (p *Parser) patternType() Token {
+	// nil is a keyword, but it is also the name of its own type
+	if p.match(TT_IDENTIFIER, TT_NIL) {
+		typeName := p.previous()
+		if !patternTypes[typeName.Lexeme] {
+			p.report(typeName, "Unknown type in pattern.")
+		}
+		return typeName
+	}
+	p.error(p.peek(), "Expect type name after ':'.")
+	return p.missing(TT_IDENTIFIER)
+}
+
+func (p *Parser) literalPattern() LiteralPattern {
+	m := p.mark()
+	if p.match(TT_FALSE) {
+		return node(p, m, LiteralPattern{Token: p.previous(), Value: false})
+	}
+	if p.match(TT_TRUE) {
+		return node(p, m, LiteralPattern{Token: p.previous(), Value: true})
+	}
+	if p.match(TT_NIL) {
+		return node(p, m, LiteralPattern{Token: p.previous(), Value: nil})
+	}
+	if p.match(TT_NUMBER, TT_STRING) {
+		return node(p, m, LiteralPattern{Token: p.previous(), Value: p.previous().Literal})
+	}
+	if p.match(TT_MINUS) {
+		sign := p.previous()
+		number := p.consume(TT_NUMBER, "Expect number after '-' in pattern.")
+		value, _ := number.Literal.(float64)
+		return node(p, m, LiteralPattern{Sign: sign, Token: number, Value: -value})
+	}
+	p.error(p.peek(), "Expect pattern.")
+	return node(p, m, LiteralPattern{Token: p.missing(TT_NIL)})
+}
+
 func (p *Parser) block() []Statement {
 	var statements []Statement
 	for !p.check(TT_RIGHT_BRACE) && !p.isAtEnd() {
@@ -170,87 +389,108 @@ func (p *Parser) expression() Expression {
 }
 
 func (p *Parser) assignment() Expression {
+	m := p.mark()
 	expr := p.equality()
 	if p.match(TT_EQUAL) {
 		var equals Token = p.previous()
 		var value Expression = p.assignment()
-		if varExpr, ok := expr.(VariableExpression); ok {
+		if varExpr, ok := expr.(*VariableExpression); ok {
 			name := varExpr.Name
-			return AssignExpression{
+			return node(p, m, &AssignExpression{
 				Name:  name,
 				Value: value,
-			}
+			})
 		}
-		parseFault(equals, "Invalid assignment target.")
+		p.report(equals, "Invalid assignment target.")
 	}
 	return expr
 }
 
 func (p *Parser) equality() Expression {
+	m := p.mark()
 	var expr = p.comparison()
 
 	for p.match(TT_BANG_EQUAL, TT_EQUAL_EQUAL) {
 		var operator Token = p.previous()
 		var right Expression = p.comparison()
-		expr = BinaryExpression{expr, operator, right}
+		expr = node(p, m, BinaryExpression{expr, operator, right})
 	}
 
 	return expr
 }
 
 func (p *Parser) comparison() Expression {
-	var expr Expression = p.term()
+	m := p.mark()
+	var expr Expression = p.rangeExpr()
 
 	for p.match(TT_GREATER, TT_GREATER_EQUAL, TT_LESS, TT_LESS_EQUAL) {
-		expr = BinaryExpression{
+		expr = node(p, m, BinaryExpression{
 			Left:     expr,
 			Operator: p.previous(),
-			Right:    p.term(),
-		}
+			Right:    p.rangeExpr(),
+		})
+	}
+	return expr
+}
+
+func (p *Parser) rangeExpr() Expression {
+	m := p.mark()
+	var expr Expression = p.term()
+
+	if p.match(TT_DOT_DOT, TT_DOT_DOT_LESS) {
+		expr = node(p, m, RangeExpression{
+			Start:    expr,
+			Operator: p.previous(),
+			End:      p.term(),
+		})
 	}
 	return expr
 }
 
 func (p *Parser) term() Expression {
+	m := p.mark()
 	var expr Expression = p.factor()
 
 	for p.match(TT_MINUS, TT_PLUS) {
-		expr = BinaryExpression{
+		expr = node(p, m, BinaryExpression{
 			Left:     expr,
 			Operator: p.previous(),
 			Right:    p.factor(),
-		}
+		})
 	}
 	return expr
 }
 
 func (p *Parser) factor() Expression {
+	m := p.mark()
 	expr := p.unary()
 	for p.match(TT_SLASH, TT_STAR) {
-		expr = BinaryExpression{
+		expr = node(p, m, BinaryExpression{
 			Left:     expr,
 			Operator: p.previous(),
 			Right:    p.unary(),
-		}
+		})
 	}
 	return expr
 }
 
 func (p *Parser) unary() Expression {
+	m := p.mark()
 	if p.match(TT_BANG, TT_MINUS) {
-		return UnaryExpression{
+		return node(p, m, UnaryExpression{
 			Operator: p.previous(),
 			Right:    p.unary(),
-		}
+		})
 	}
 	return p.call()
 }
 
 func (p *Parser) call() Expression {
+	m := p.mark()
 	expr := p.primary()
 	for true {
 		if p.match(TT_LEFT_PAREN) {
-			expr = p.finishCall(expr)
+			expr = node(p, m, p.finishCall(expr))
 		} else {
 			break
 		}
@@ -263,7 +503,7 @@ func (p *Parser) finishCall(callee Expression) Expression {
 	if !p.check(TT_RIGHT_PAREN) {
 		for true {
 			if len(arguments) >= 255 {
-				parseFault(p.peek(), "Can't have more than 255 arguments.")
+				p.report(p.peek(), "Can't have more than 255 arguments.")
 			}
 			arguments = append(arguments, p.expression())
 			if !p.match(TT_COMMA) {
@@ -280,41 +520,114 @@ func (p *Parser) finishCall(callee Expression) Expression {
 }
 
 func (p *Parser) primary() Expression {
+	m := p.mark()
 	if p.match(TT_FALSE) {
-		return LiteralExpression{false}
+		return node(p, m, LiteralExpression{Value: false, Token: p.previous()})
 	}
 	if p.match(TT_TRUE) {
-		return LiteralExpression{true}
+		return node(p, m, LiteralExpression{Value: true, Token: p.previous()})
 	}
 	if p.match(TT_NIL) {
-		return LiteralExpression{nil}
+		return node(p, m, LiteralExpression{Value: nil, Token: p.previous()})
 	}
 
 	if p.match(TT_NUMBER, TT_STRING) {
-		return LiteralExpression{p.previous().Literal}
+		return node(p, m, LiteralExpression{Value: p.previous().Literal, Token: p.previous()})
 	}
 	if p.match(TT_IDENTIFIER) {
-		return VariableExpression{Name: p.previous()}
+		return node(p, m, &VariableExpression{Name: p.previous()})
 	}
 	if p.match(TT_LEFT_PAREN) {
+		leftParen := p.previous()
 		expr := p.expression()
-		p.consume(TT_RIGHT_PAREN, "expect ')' after expression.")
-		return GroupingExpression{expr}
+		rightParen := p.consume(TT_RIGHT_PAREN, "expect ')' after expression.")
+		return node(p, m, GroupingExpression{Expression: expr, LeftParen: leftParen, RightParen: rightParen})
+	}
+	if p.match(TT_LEFT_BRACKET) {
+		return node(p, m, p.list())
+	}
+	if p.match(TT_LEFT_BRACE) {
+		return node(p, m, p.mapLiteral())
 	}
 
-	panic(p.error(p.peek(), "Expect expression."))
+	p.error(p.peek(), "Expect expression.")
+	return node(p, m, ErrorExpression{Token: p.peek()})
+}
+
+func (p *Parser) list() Expression {
+	bracket := p.previous()
+	var elements []Expression
+	if !p.check(TT_RIGHT_BRACKET) {
+		for true {
+			elements = append(elements, p.expression())
+			if !p.match(TT_COMMA) {
+				break
+			}
+		}
+	}
+	closing := p.consume(TT_RIGHT_BRACKET, "Expect ']' after list elements.")
+	return ListExpression{
+		Bracket:  bracket,
+		Elements: elements,
+		Closing:  closing,
+	}
+}
+
+func (p *Parser) mapLiteral() Expression {
+	brace := p.previous()
+	var keys []Expression
+	var values []Expression
+	if !p.check(TT_RIGHT_BRACE) {
+		for true {
+			keys = append(keys, p.expression())
+			p.consume(TT_COLON, "Expect ':' after map key.")
+			values = append(values, p.expression())
+			if !p.match(TT_COMMA) {
+				break
+			}
+		}
+	}
+	closing := p.consume(TT_RIGHT_BRACE, "Expect '}' after map entries.")
+	return MapExpression{
+		Brace:   brace,
+		Keys:    keys,
+		Values:  values,
+		Closing: closing,
+	}
 }
 
 func (p *Parser) consume(tokenType TokenType, message string) Token {
 	if p.check(tokenType) {
 		return p.advance()
 	}
-	panic(p.error(p.peek(), message))
+	p.error(p.peek(), message)
+	return p.missing(tokenType)
+}
+
+// missing returns an empty token of the given type at the current position,
+// standing in for a token that consume expected but did not find.
+func (p *Parser) missing(tokenType TokenType) Token {
+	token := p.peek()
+	token.TokenType = tokenType
+	token.Lexeme = ""
+	token.Literal = nil
+	token.End = token.Start
+	return token
+}
+
+// error records a syntax error and enters panic mode, which lasts until
+// the enclosing declaration has been skipped.
+func (p *Parser) error(token Token, message string) {
+	if p.panicMode {
+		return
+	}
+	p.panicMode = true
+	p.report(token, message)
 }
 
-func (p *Parser) error(token Token, message string) error {
-	parseFault(token, message)
-	return ParseError
+// report records a syntax error that does not throw the parser off track.
+func (p *Parser) report(token Token, message string) {
+	p.errors = append(p.errors, SyntaxError{Token: token, Message: message})
 }
 
 func (p *Parser) match(types ...TokenType) bool {
@@ -351,17 +664,30 @@ func (p *Parser) isAtEnd() bool {
 func (p *Parser) advance() Token {
 	if !p.isAtEnd() {
 		p.current++
+		if p.cst != nil {
+			p.cst.token(p.previous())
+		}
 	}
 	return p.previous()
 }
 
-func (p *Parser) synchronize() {
-	p.advance()
+// synchronize skips tokens up to the next likely statement boundary. start
+// is where the failed declaration began; at least one token is skipped so
+// that parsing always makes progress.
+func (p *Parser) synchronize(start int) {
+	if p.current == start && !p.isAtEnd() {
+		p.advance()
+	}
 	for !p.isAtEnd() {
-		if p.previous().TokenType == TT_SEMICOLON {
+		switch p.previous().TokenType {
+		case TT_SEMICOLON:
+			return
+		case TT_RIGHT_BRACE:
 			return
 		}
 		switch p.peek().TokenType {
+		case TT_RIGHT_BRACE:
+			return
 		case TT_CLASS:
 			return
 		case TT_FUN:
@@ -372,12 +698,16 @@ func (p *Parser) synchronize() {
 			return
 		case TT_RETURN:
 			return
+		case TT_YIELD:
+			return
 		case TT_IF:
 			return
 		case TT_WHILE:
 			return
 		case TT_PRINT:
 			return
+		case TT_MATCH:
+			return
 		}
 		p.advance()
 	}
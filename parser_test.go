@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func parse(source string) ([]Statement, []string) {
+	stmts, errs := NewParser(NewScanner(source).ScanTokens()).Parse()
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return stmts, messages
+}
+
+func TestParser_Diagnostics(t *testing.T) {
+	cases := map[string][]string{
+		"print 1;": nil,
+		"var = 1;": {
+			"1:5 at '=': Expect variable name.",
+		},
+		"print 2\nprint 3;": {
+			"2:1 at 'print': Expect ';' after value.",
+		},
+		"var a = (1 + ;\nvar b = ;\nprint a": {
+			"1:14 at ';': Expect expression.",
+			"2:9 at ';': Expect expression.",
+			"3:8 at end: Expect ';' after value.",
+		},
+		"fun f( { print 3; }\nf();": {
+			"1:8 at '{': Expect parameter name.",
+		},
+		"{ print ; }\n1 = 2;": {
+			"1:9 at ';': Expect expression.",
+			"2:3 at '=': Invalid assignment target.",
+		},
+		"match (1) { => print 1; }": {
+			"1:13 at '=>': Expect pattern.",
+		},
+		"match (x) { v: float => print v; }": {
+			"1:16 at 'float': Unknown type in pattern.",
+		},
+		"while (true print 1;": {
+			"1:13 at 'print': Expect ')' after condition.",
+		},
+	}
+	for source, want := range cases {
+		_, got := parse(source)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q\n got: %q\nwant: %q", source, got, want)
+		}
+	}
+}
+
+func TestParser_ErrorNodes(t *testing.T) {
+	stmts, _ := parse("print 1;\nvar = 2;\nprint 3;")
+	if len(stmts) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(stmts))
+	}
+	if _, ok := stmts[0].(PrintStatement); !ok {
+		t.Errorf("statement 0 is %T", stmts[0])
+	}
+	bad, ok := stmts[1].(ErrorStatement)
+	if !ok || bad.From.Lexeme != "var" || bad.To.Lexeme != ";" {
+		t.Errorf("statement 1 is %#v", stmts[1])
+	}
+	if _, ok := stmts[2].(PrintStatement); !ok {
+		t.Errorf("statement 2 is %T", stmts[2])
+	}
+}
+
+func TestParser_NestedRecovery(t *testing.T) {
+	stmts, errs := parse("fun f() {\n  print ;\n  print 1;\n}")
+	if len(errs) != 1 {
+		t.Fatalf("got errors %q", errs)
+	}
+	body := stmts[0].(FunctionStatement).Body
+	if _, ok := body[0].(ErrorStatement); !ok || len(body) != 2 {
+		t.Errorf("body is %#v", body)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+type Pattern interface {
+	Accept(visitor PatternVisitor) Any
+	Span() Span
+}
+
+type PatternVisitor interface {
+	visitWildcardPattern(pattern WildcardPattern) Any
+	visitLiteralPattern(pattern LiteralPattern) Any
+	visitBindingPattern(pattern BindingPattern) Any
+	visitTypePattern(pattern TypePattern) Any
+	visitListPattern(pattern ListPattern) Any
+	visitMapPattern(pattern MapPattern) Any
+}
+
+// WildcardPattern `_` matches any value without binding it.
+type WildcardPattern struct {
+	Token Token
+}
+
+func (p WildcardPattern) Accept(visitor PatternVisitor) Any {
+	return visitor.visitWildcardPattern(p)
+}
+
+func (p WildcardPattern) Span() Span {
+	return p.Token.Span()
+}
+
+// LiteralPattern matches values equal to a number, string, boolean or nil.
+type LiteralPattern struct {
+	// Sign is the '-' of a negative number, if any
+	Sign  Token
+	Token Token
+	Value Any
+}
+
+func (p LiteralPattern) Accept(visitor PatternVisitor) Any {
+	return visitor.visitLiteralPattern(p)
+}
+
+func (p LiteralPattern) Span() Span {
+	return p.Sign.Span().To(p.Token.Span())
+}
+
+// BindingPattern matches any value and binds it to Name inside the arm.
+type BindingPattern struct {
+	Name Token
+}
+
+func (p BindingPattern) Accept(visitor PatternVisitor) Any {
+	return visitor.visitBindingPattern(p)
+}
+
+func (p BindingPattern) Span() Span {
+	return p.Name.Span()
+}
+
+// TypePattern `name: type` matches values of the given runtime type and
+// binds them to Name, unless Name is the wildcard `_`.
+type TypePattern struct {
+	Name     Token
+	TypeName Token
+}
+
+func (p TypePattern) Accept(visitor PatternVisitor) Any {
+	return visitor.visitTypePattern(p)
+}
+
+func (p TypePattern) Span() Span {
+	return p.Name.Span().To(p.TypeName.Span())
+}
+
+// ListPattern matches lists of exactly the same length whose elements match
+// the element patterns pairwise.
+type ListPattern struct {
+	Bracket  Token
+	Elements []Pattern
+	Closing  Token
+}
+
+func (p ListPattern) Accept(visitor PatternVisitor) Any {
+	return visitor.visitListPattern(p)
+}
+
+func (p ListPattern) Span() Span {
+	return p.Bracket.Span().To(p.Closing.Span())
+}
+
+// MapPattern matches maps containing every listed key with a value matching
+// the corresponding pattern. Keys not mentioned in the pattern are ignored.
+type MapPattern struct {
+	Brace   Token
+	Keys    []Any
+	Values  []Pattern
+	Closing Token
+}
+
+func (p MapPattern) Accept(visitor PatternVisitor) Any {
+	return visitor.visitMapPattern(p)
+}
+
+func (p MapPattern) Span() Span {
+	return p.Brace.Span().To(p.Closing.Span())
+}
+
+// patternTypes lists the type names accepted by a TypePattern.
+var patternTypes = map[string]bool{
+	"number":   true,
+	"string":   true,
+	"bool":     true,
+	"nil":      true,
+	"list":     true,
+	"map":      true,
+	"range":    true,
+	"function": true,
+}
+
+// typeName returns the name a TypePattern uses for the runtime type of value.
+func typeName(value Any) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case *List:
+		return "list"
+	case *Map:
+		return "map"
+	case *Range:
+		return "range"
+	case Callable:
+		return "function"
+	}
+	return "unknown"
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+/*
+	Permissions
+
+	Native functions that reach outside the interpreter, such as readFile
+	and env, are privileged: they check that the Permissions of the
+	interpreter grant access to the resource they are asked for, and fail
+	with a runtime error otherwise. Interpreters start sandboxed, with no
+	permissions at all.
+
+	A permission is written kind:resources, where resources is a comma
+	separated list of patterns, "*" for any resource, or "none":
+
+	  fs.read:/data/*      read files under /data
+	  fs.write:/tmp        write files under /tmp
+	  env:HOME,LANG        read the HOME and LANG environment variables
+	  net:example.com      connect to example.com
+	  exec:none            run no programs
+
+	Patterns use filepath.Match syntax. File patterns are made absolute,
+	with the symbolic links in their directories resolved, and also match
+	everything below the files they match. Paths are checked after resolving
+	symbolic links, so a link cannot lead out of a granted directory, and
+	files that do not exist are denied; the resolved path is the one
+	accessed.
+
+	`gs run` grants permissions with --allow-read[=paths] and
+	--allow-env[=names]; without a value they grant everything of their
+	kind.
+*/
+
+const (
+	PERM_FS_READ  = "fs.read"
+	PERM_FS_WRITE = "fs.write"
+	PERM_ENV      = "env"
+	PERM_NET      = "net"
+	PERM_EXEC     = "exec"
+)
+
+var permissionKinds = []string{PERM_FS_READ, PERM_FS_WRITE, PERM_ENV, PERM_NET, PERM_EXEC}
+
+// Permissions maps each kind of permission to the patterns of the
+// resources it grants.
+type Permissions struct {
+	grants map[string][]string
+}
+
+// Sandboxed returns permissions that deny everything.
+func Sandboxed() *Permissions {
+	return &Permissions{grants: make(map[string][]string)}
+}
+
+// Unrestricted returns permissions that grant everything.
+func Unrestricted() *Permissions {
+	p := Sandboxed()
+	for _, kind := range permissionKinds {
+		p.grants[kind] = []string{"*"}
+	}
+	return p
+}
+
+// ParsePermissions returns sandboxed permissions extended with the grants
+// written in specs.
+func ParsePermissions(specs ...string) (*Permissions, error) {
+	p := Sandboxed()
+	for _, spec := range specs {
+		if err := p.Grant(spec); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Grant adds the permission written in spec, such as "fs.read:/data/*".
+func (p *Permissions) Grant(spec string) error {
+	kind, resources, found := strings.Cut(spec, ":")
+	if !found {
+		resources = "*"
+	}
+	known := false
+	for _, k := range permissionKinds {
+		known = known || k == kind
+	}
+	if !known {
+		return fmt.Errorf("unknown permission %q, expected one of %s", kind, strings.Join(permissionKinds, ", "))
+	}
+	if resources == "none" {
+		return nil
+	}
+	for _, pattern := range strings.Split(resources, ",") {
+		if pattern == "" {
+			return fmt.Errorf("empty resource in permission %q", spec)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q in permission %q", pattern, spec)
+		}
+		if isFileKind(kind) && pattern != "*" {
+			resolved, err := resolvePattern(pattern)
+			if err != nil {
+				return err
+			}
+			pattern = resolved
+		}
+		p.grants[kind] = append(p.grants[kind], pattern)
+	}
+	return nil
+}
+
+// Allows reports whether the permissions grant kind access to resource.
+// Nil permissions are sandboxed.
+func (p *Permissions) Allows(kind string, resource string) bool {
+	_, ok := p.check(kind, resource)
+	return ok
+}
+
+// check reports whether the permissions grant kind access to resource, and
+// returns the resource to access: for files, the path with its symbolic
+// links resolved that was checked, so that the file read is the one allowed.
+func (p *Permissions) check(kind string, resource string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	patterns := p.grants[kind]
+	if slices.Contains(patterns, "*") {
+		return resource, true
+	}
+	candidates := []string{resource}
+	if isFileKind(kind) {
+		path, ok := resolvePath(resource)
+		if !ok {
+			return "", false
+		}
+		resource = path
+		candidates = withParents(path)
+	}
+	for _, pattern := range patterns {
+		for _, candidate := range candidates {
+			if matched, _ := filepath.Match(pattern, candidate); matched {
+				return resource, true
+			}
+		}
+	}
+	return "", false
+}
+
+func isFileKind(kind string) bool {
+	return kind == PERM_FS_READ || kind == PERM_FS_WRITE
+}
+
+// resolvePath returns the absolute path of a file with its symbolic links
+// resolved, and false if that can't be done, for instance because the file
+// does not exist. Links are resolved before the path is cleaned, since
+// cleaning "link/.." to "." would skip where the link leads.
+func resolvePath(path string) (string, bool) {
+	if !filepath.IsAbs(path) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", false
+		}
+		path = wd + string(filepath.Separator) + path
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	return resolved, err == nil
+}
+
+// resolvePattern makes a file pattern absolute and resolves the symbolic
+// links in its literal directories, those before the first wildcard, so
+// that it matches the resolved paths checked against it.
+func resolvePattern(pattern string) (string, error) {
+	if !filepath.IsAbs(pattern) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		pattern = wd + string(filepath.Separator) + pattern
+	}
+	wildcards := `*?[\`
+	if filepath.Separator == '\\' {
+		wildcards = "*?["
+	}
+	prefix, rest := pattern, ""
+	if n := strings.IndexAny(pattern, wildcards); n >= 0 {
+		n = strings.LastIndexByte(pattern[:n], filepath.Separator)
+		prefix, rest = pattern[:n], pattern[n:]
+	}
+	if resolved, err := filepath.EvalSymlinks(prefix); err == nil {
+		prefix = resolved
+	}
+	return filepath.Clean(prefix + rest), nil
+}
+
+// withParents returns path followed by the directories containing it.
+func withParents(path string) []string {
+	candidates := []string{path}
+	for dir := filepath.Dir(path); dir != path; dir = filepath.Dir(path) {
+		candidates = append(candidates, dir)
+		path = dir
+	}
+	return candidates
+}
+
+// require fails the running native function unless the interpreter is
+// permitted kind access to resource, and returns the resource to access,
+// see Permissions.check.
+func (i *Interpreter) require(kind string, resource string) string {
+	checked, ok := i.root().Permissions.check(kind, resource)
+	if !ok {
+		panic(nativeError(fmt.Sprintf("Requires %s permission for %q.", kind, resource)))
+	}
+	return checked
+}
+
+// permissionFlag is a command line flag granting a kind of permission, for
+// all resources if it has no value, or for a comma separated list of them.
+type permissionFlag struct {
+	kind        string
+	permissions *Permissions
+}
+
+func (f permissionFlag) String() string {
+	if f.permissions == nil {
+		return ""
+	}
+	return strings.Join(f.permissions.grants[f.kind], ",")
+}
+
+func (f permissionFlag) Set(value string) error {
+	switch value {
+	case "true":
+		return f.permissions.Grant(f.kind)
+	case "false":
+		return nil
+	}
+	return f.permissions.Grant(f.kind + ":" + value)
+}
+
+func (f permissionFlag) IsBoolFlag() bool {
+	return true
+}
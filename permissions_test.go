@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPermissions(t *testing.T) {
+	// resolved, so that paths can be compared with the ones checked
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := filepath.Join(dir, "data")
+	outside := filepath.Join(dir, "outside")
+	for _, sub := range []string{filepath.Join(data, "sub"), filepath.Join(outside, "x")} {
+		if err := os.MkdirAll(sub, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secret := filepath.Join(dir, "secret.txt")
+	for _, file := range []string{secret, filepath.Join(data, "sub", "a.txt"), filepath.Join(outside, "secret")} {
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(secret, filepath.Join(data, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(data, "sub", "a.txt"), filepath.Join(data, "alias.txt")); err != nil {
+		t.Fatal(err)
+	}
+	alias := filepath.Join(dir, "alias")
+	if err := os.Symlink(data, alias); err != nil {
+		t.Fatal(err)
+	}
+	// data/link/.. is outside, not data
+	if err := os.Symlink(filepath.Join(outside, "x"), filepath.Join(data, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		specs    []string
+		kind     string
+		resource string
+		want     bool
+	}{
+		{nil, PERM_FS_READ, secret, false},
+		{nil, PERM_ENV, "HOME", false},
+		{[]string{"fs.read:" + data}, PERM_FS_READ, data, true},
+		{[]string{"fs.read:" + data}, PERM_FS_READ, filepath.Join(data, "sub", "a.txt"), true},
+		{[]string{"fs.read:" + data}, PERM_FS_READ, filepath.Join(data, "..", "secret.txt"), false},
+		{[]string{"fs.read:" + data}, PERM_FS_READ, filepath.Join(data, "link.txt"), false},
+		{[]string{"fs.read:" + data}, PERM_FS_READ, filepath.Join(data, "alias.txt"), true},
+		{[]string{"fs.read:" + data}, PERM_FS_READ, data + "/link/../secret", false},
+		{[]string{"fs.read:" + data}, PERM_FS_READ, filepath.Join(data, "sub", "missing.txt"), false},
+		{[]string{"fs.read:" + data}, PERM_FS_WRITE, filepath.Join(data, "a.txt"), false},
+		{[]string{"fs.read:" + data + "/*"}, PERM_FS_READ, filepath.Join(data, "sub", "a.txt"), true},
+		{[]string{"fs.read:" + data + "/*"}, PERM_FS_READ, data, false},
+		{[]string{"fs.read:" + alias}, PERM_FS_READ, filepath.Join(alias, "sub", "a.txt"), true},
+		{[]string{"fs.read:" + alias}, PERM_FS_READ, filepath.Join(data, "sub", "a.txt"), true},
+		{[]string{"fs.read:" + alias + "/s*"}, PERM_FS_READ, filepath.Join(alias, "sub", "a.txt"), true},
+		{[]string{"fs.read:" + alias + "/../outside"}, PERM_FS_READ, filepath.Join(outside, "secret"), true},
+		{[]string{"fs.read:" + data + "," + secret}, PERM_FS_READ, secret, true},
+		{[]string{"fs.read"}, PERM_FS_READ, secret, true},
+		{[]string{"env:HOME,LC_*"}, PERM_ENV, "HOME", true},
+		{[]string{"env:HOME,LC_*"}, PERM_ENV, "LC_ALL", true},
+		{[]string{"env:HOME,LC_*"}, PERM_ENV, "PATH", false},
+		{[]string{"env:*"}, PERM_ENV, "PATH", true},
+		{[]string{"exec:none"}, PERM_EXEC, "ls", false},
+	}
+	for _, test := range tests {
+		p, err := ParsePermissions(test.specs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Allows(test.kind, test.resource); got != test.want {
+			t.Errorf("%q allows %s %s = %v, want %v", test.specs, test.kind, test.resource, got, test.want)
+		}
+	}
+
+	// the file accessed is the one checked, not the link to it
+	p, _ := ParsePermissions("fs.read:" + data)
+	if got, _ := p.check(PERM_FS_READ, filepath.Join(data, "alias.txt")); got != filepath.Join(data, "sub", "a.txt") {
+		t.Errorf("checked %q", got)
+	}
+
+	var none *Permissions
+	if none.Allows(PERM_ENV, "HOME") {
+		t.Error("nil permissions allow env")
+	}
+	if !Unrestricted().Allows(PERM_EXEC, "ls") {
+		t.Error("Unrestricted denies exec")
+	}
+	for _, spec := range []string{"disk:/", "env:", "env:[", "fs.read:a,,b"} {
+		if _, err := ParsePermissions(spec); err == nil {
+			t.Errorf("ParsePermissions(%q) succeeded", spec)
+		}
+	}
+}
+
+// Permissions granted after a generator started apply when it is resumed.
+func TestPermissions_Generator(t *testing.T) {
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		newSession(t)
+		source := "fun g() { yield 1; yield env(\"HOME\"); }\nvar it = g();\nit();"
+		if err := runProgram(t, context.Background(), engine, source); err != nil {
+			t.Fatal(err)
+		}
+		interpreter.Permissions = Unrestricted()
+		if err := runProgram(t, context.Background(), engine, "it();"); err != nil {
+			t.Errorf("%s: %v", engine, err)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+/*
+	REPL
+
+	The prompt reads input until its brackets are balanced and it does not end
+	inside a string or block comment, showing a continuation prompt for every
+	further line. Expressions entered on their own, with or without a
+	trailing semicolon, echo their value unless it is nil or they assign.
+
+	On a terminal lines can be edited and recalled, and are kept across
+	sessions in ~/.gs_history. Ctrl-C abandons the current input, or stops
+	the program it started if that is still running, and Ctrl-D on an empty
+	line leaves, and Tab completes names (see completion.go).
+	Lines starting with ':' are commands, see replHelp.
+*/
+
+const (
+	replPrompt         = "> "
+	replContinuePrompt = ". "
+	historyFile        = ".gs_history"
+	historySize        = 1000
+)
+
+const replHelp = `Commands:
+  :help         show this help
+  :env          list the global variables and their values
+  :load <file>  run a script in this session
+  :reset        forget all definitions
+  :ast <code>   print the syntax tree of code without running it
+  :quit         leave, as does Ctrl-D
+`
+
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads input for the REPL. It returns errInterrupted when the
+// user presses Ctrl-C and io.EOF at the end of input.
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+type Repl struct {
+	input lineReader
+	// pending holds the earlier lines of an input being continued
+	pending string
+}
+
+func NewRepl() *Repl {
+	if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+		r := &Repl{}
+		r.input = newTerminalReader(r.complete)
+		return r
+	}
+	return &Repl{input: &plainReader{reader: bufio.NewReader(os.Stdin)}}
+}
+
+// runPrompt runs the REPL until the input ends or a script calls exit, and
+// returns the exit status.
+func runPrompt() int {
+	return NewRepl().Run()
+}
+
+func (r *Repl) Run() int {
+	for {
+		source, err := r.read()
+		if err == io.EOF {
+			return EXIT_OK
+		}
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return EXIT_NO_INPUT
+		}
+
+		// Ctrl-C while the input runs stops it rather than the REPL
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		if command, ok := strings.CutPrefix(strings.TrimSpace(source), ":"); ok {
+			if !r.command(ctx, command) {
+				stop()
+				return EXIT_OK
+			}
+		} else {
+			r.eval(ctx, "<stdin>", source)
+		}
+		stop()
+		if exitCode >= 0 {
+			return exitCode
+		}
+		hadError, hadRuntimeError = false, false
+		interpreter.forgetScriptLocals()
+	}
+}
+
+// read reads one complete input, prompting for further lines while it is
+// incomplete.
+func (r *Repl) read() (string, error) {
+	line, err := r.input.readLine(replPrompt)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(strings.TrimSpace(line), ":") {
+		return line, nil
+	}
+	source := line
+	defer func() { r.pending = "" }()
+	for incomplete(source) {
+		r.pending = source
+		line, err := r.input.readLine(replContinuePrompt)
+		if err == io.EOF {
+			// run what there is and let it report what is missing
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		source += "\n" + line
+	}
+	return source, nil
+}
+
+// eval runs source until ctx is done, echoing the value of a final
+// expression statement.
+func (r *Repl) eval(ctx context.Context, name string, source string) {
+	if !parses(source) && parses(source+";") {
+		source += ";"
+	}
+	stmts := compile(name, source)
+	if len(stmts) == 0 {
+		return
+	}
+	last, ok := stmts[len(stmts)-1].(ExpressionStatement)
+	if _, assigns := last.Expression.(*AssignExpression); !ok || assigns {
+		interpreter.InterpretContext(ctx, stmts)
+		return
+	}
+	interpreter.InterpretContext(ctx, stmts[:len(stmts)-1])
+	if hadRuntimeError || exitCode >= 0 {
+		return
+	}
+	defer interpreter.withContext(ctx)()
+	value := interpreter.InterpretExpression(last.Expression)
+	if !hadRuntimeError && value != nil {
+		fmt.Fprintln(stdout, interpreter.stringify(value))
+	}
+}
+
+// command runs a meta-command, stopping any script it runs once ctx is
+// done, and returns false if the REPL should end.
+func (r *Repl) command(ctx context.Context, command string) bool {
+	name, argument, _ := strings.Cut(command, " ")
+	argument = strings.TrimSpace(argument)
+	switch name {
+	case "help":
+		fmt.Fprint(stdout, replHelp)
+	case "env":
+		for _, name := range interpreter.globals.names() {
+			fmt.Fprintf(stdout, "%s = %s\n", name, interpreter.stringify(interpreter.globals.values[name]))
+		}
+	case "load":
+		if argument == "" {
+			fmt.Fprintln(stderr, "Usage: :load <file>")
+			break
+		}
+		name, source, err := readSource(argument)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			break
+		}
+		runContext(ctx, name, source)
+	case "reset":
+		interpreter = NewInterpreter()
+		defineArgs(nil)
+	case "ast":
+		r.printAst(argument)
+	case "quit", "exit":
+		return false
+	default:
+		fmt.Fprintf(stderr, "Unknown command ':%s'. Type :help for a list of commands.\n", name)
+	}
+	return true
+}
+
+// printAst prints the S-expression of code, which like input to the prompt
+// needs no semicolon if it is a single expression.
+func (r *Repl) printAst(code string) {
+	if !parses(code) && parses(code+";") {
+		code += ";"
+	}
+	currentSource = NewSource("<stdin>", code)
+	stmts, errs := NewParser(NewScanner(code).ScanTokens()).Parse()
+	for _, err := range errs {
+		parseFault(err.Token, err.Message)
+	}
+	if hadError {
+		return
+	}
+	printer := &AstPrinter{}
+	if stmt, ok := stmts[0].(ExpressionStatement); ok && len(stmts) == 1 {
+		fmt.Fprintln(stdout, printer.Print(stmt.Expression))
+		return
+	}
+	fmt.Fprint(stdout, printer.PrintProgram(stmts))
+}
+
+// incomplete reports whether source has unclosed brackets or ends inside a
+// string or block comment.
+func incomplete(source string) bool {
+	var scanner *Scanner
+	var tokens []Token
+	quietly(func() {
+		scanner = NewScanner(source)
+		tokens = scanner.ScanTokens()
+	})
+	if scanner.unterminated {
+		return true
+	}
+	depth := 0
+	for _, token := range tokens {
+		switch token.TokenType {
+		case TT_LEFT_PAREN, TT_LEFT_BRACE, TT_LEFT_BRACKET:
+			depth++
+		case TT_RIGHT_PAREN, TT_RIGHT_BRACE, TT_RIGHT_BRACKET:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// parses reports whether source is free of syntax errors.
+func parses(source string) bool {
+	ok := false
+	quietly(func() {
+		_, errs := NewParser(NewScanner(source).ScanTokens()).Parse()
+		ok = len(errs) == 0 && !hadError
+	})
+	return ok
+}
+
+// quietly runs f without reporting diagnostics.
+func quietly(f func()) {
+	savedStderr, savedError := stderr, hadError
+	defer func() { stderr, hadError = savedStderr, savedError }()
+	stderr, hadError = io.Discard, false
+	f()
+}
+
+type plainReader struct {
+	reader *bufio.Reader
+}
+
+func (p *plainReader) readLine(prompt string) (string, error) {
+	line, err := p.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// terminalReader edits lines on a terminal, switching it to raw mode only
+// while reading so that scripts write to it as usual.
+type terminalReader struct {
+	fd       int
+	terminal *term.Terminal
+	stdin    *interruptReader
+}
+
+// newTerminalReader returns a terminalReader that calls complete when Tab
+// is pressed.
+func newTerminalReader(complete func(line string, pos int) (string, int, string)) *terminalReader {
+	stdin := &interruptReader{reader: os.Stdin}
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{stdin, os.Stdout}, replPrompt)
+	terminal.History = loadHistory(stdin)
+	terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		line, pos, hint := complete(line, pos)
+		if hint != "" {
+			// Write puts the hint above the prompt and redraws the line
+			terminal.Write([]byte(hint + "\n"))
+		}
+		return line, pos, true
+	}
+	return &terminalReader{fd: int(os.Stdin.Fd()), terminal: terminal, stdin: stdin}
+}
+
+func (t *terminalReader) readLine(prompt string) (string, error) {
+	if width, height, err := term.GetSize(t.fd); err == nil && width > 0 {
+		t.terminal.SetSize(width, height)
+	}
+	state, err := term.MakeRaw(t.fd)
+	if err != nil {
+		return "", err
+	}
+	t.terminal.SetPrompt(prompt)
+	line, err := t.terminal.ReadLine()
+	term.Restore(t.fd, state)
+
+	if t.stdin.interrupted {
+		t.stdin.interrupted = false
+		return "", errInterrupted
+	}
+	if err == term.ErrPasteIndicator {
+		err = nil
+	}
+	if err == io.EOF {
+		// end the prompt line before leaving
+		fmt.Println()
+	}
+	return line, err
+}
+
+// interruptReader turns Ctrl-C, which term.Terminal treats like Ctrl-D,
+// into Enter and remembers that it was pressed.
+type interruptReader struct {
+	reader      io.Reader
+	interrupted bool
+}
+
+func (r *interruptReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	for i := range n {
+		if p[i] == 3 {
+			p[i] = '\r'
+			r.interrupted = true
+		}
+	}
+	return n, err
+}
+
+// history implements term.History, appending every entry to a file so that
+// it is kept across sessions.
+type history struct {
+	entries []string
+	file    *os.File
+	stdin   *interruptReader
+}
+
+func loadHistory(stdin *interruptReader) *history {
+	h := &history{stdin: stdin}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return h
+	}
+	path := filepath.Join(home, historyFile)
+	if bytes, err := os.ReadFile(path); err == nil && len(bytes) > 0 {
+		h.entries = strings.Split(strings.TrimSuffix(string(bytes), "\n"), "\n")
+		if len(h.entries) > historySize {
+			// rewrite the file so it does not grow without bound
+			h.entries = h.entries[len(h.entries)-historySize:]
+			os.WriteFile(path, []byte(strings.Join(h.entries, "\n")+"\n"), 0600)
+		}
+	}
+	h.file, _ = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	return h
+}
+
+func (h *history) Add(entry string) {
+	if strings.TrimSpace(entry) == "" || h.stdin.interrupted ||
+		(len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if h.file != nil {
+		fmt.Fprintln(h.file, entry)
+	}
+}
+
+func (h *history) Len() int {
+	return len(h.entries)
+}
+
+func (h *history) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestRepl_Incomplete(t *testing.T) {
+	cases := map[string]bool{
+		"print 1;":       false,
+		"fun f() {":      true,
+		"print (1 +":     true,
+		"var l = [1,\n2": true,
+		"print \"open":   true,
+		"/* comment":     true,
+		"print \")\";":   false,
+		"{ print 1; }":   false,
+		"print 1; // {":  false,
+		"}":              false,
+	}
+	for source, want := range cases {
+		if got := incomplete(source); got != want {
+			t.Errorf("incomplete(%q) = %v, want %v", source, got, want)
+		}
+	}
+}
+
+func TestRepl_Session(t *testing.T) {
+	input := "var a = 2;\na * 3\nfun f(x) {\n  return x;\n}\nf(nil);\na = 4;\nprint a\n:ast -a + 1\n:reset\na\n"
+	s := newSession(t)
+
+	repl := &Repl{input: &plainReader{reader: bufio.NewReader(strings.NewReader(input))}}
+	if status := repl.Run(); status != EXIT_OK {
+		t.Errorf("exit status %d", status)
+	}
+	if want := "6.000000\n4.000000\n(+ (- a) 1)\n"; s.out.String() != want {
+		t.Errorf("got output %q, want %q", s.out.String(), want)
+	}
+	if !strings.Contains(s.errOut.String(), "Undefined variable 'a'.") {
+		t.Errorf("got diagnostics %q", s.errOut.String())
+	}
+}
+
+// Locals of code outside functions are dropped once it has run, while
+// those of functions declared in earlier inputs are kept.
+func TestRepl_ForgetsScriptLocals(t *testing.T) {
+	input := "fun f(x) {\n  return x;\n}\n{ var a = 1; print a; }\nfor (i in 0..<2) print i;\nf(2)\n"
+	s := newSession(t)
+
+	repl := &Repl{input: &plainReader{reader: bufio.NewReader(strings.NewReader(input))}}
+	repl.Run()
+	if want := "1.000000\n0.000000\n1.000000\n2.000000\n"; s.out.String() != want {
+		t.Errorf("got output %q, want %q", s.out.String(), want)
+	}
+	if len(interpreter.locals) != 1 {
+		t.Errorf("%d locals kept, want 1", len(interpreter.locals))
+	}
+}
+
+func TestRepl_ReadError(t *testing.T) {
+	s := newSession(t)
+	repl := &Repl{input: &plainReader{reader: bufio.NewReader(iotest.ErrReader(errors.New("read failed")))}}
+	if status := repl.Run(); status != EXIT_NO_INPUT {
+		t.Errorf("exit status %d, want %d", status, EXIT_NO_INPUT)
+	}
+	if s.errOut.String() != "read failed\n" {
+		t.Errorf("got diagnostics %q", s.errOut.String())
+	}
+}
+
+func TestRepl_Complete(t *testing.T) {
+	newSession(t)
+	run("<test>", "fun fibonacci(n) { return n; } var first = 1; var second = 2;")
+
+	repl := &Repl{pending: "var sum = 0;"}
+	cases := []struct {
+		line     string
+		pos      int
+		want     string
+		wantPos  int
+		wantHint string
+	}{
+		{"print fib", 9, "print fibonacci", 15, "fibonacci(n)"},
+		{"fib + 1", 3, "fibonacci + 1", 9, "fibonacci(n)"},
+		{"print f", 7, "print f", 7, "false  fibonacci(n)  first  for  fun"},
+		{"se", 2, "second", 6, ""},
+		{"wh", 2, "while", 5, ""},
+		{"su", 2, "su", 2, "sum  super"},
+		{"fibonacci(1, ", 13, "fibonacci(1, ", 13, "fibonacci(n)"},
+		{"exit(", 5, "exit(", 5, "exit(code)"},
+		{"zzz", 3, "zzz", 3, ""},
+	}
+	for _, c := range cases {
+		line, pos, hint := repl.complete(c.line, c.pos)
+		if line != c.want || pos != c.wantPos || hint != c.wantHint {
+			t.Errorf("complete(%q, %d) = %q, %d, %q", c.line, c.pos, line, pos, hint)
+		}
+	}
+}
+
+// Ctrl-C while an input runs stops that input and leaves the REPL running.
+func TestRepl_InterruptStopsEvaluation(t *testing.T) {
+	// keep stray interrupts from killing the test binary before the REPL
+	// is listening for them
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	input := "while (true) {}\nprint 1;\n"
+	s := newSession(t)
+
+	repl := &Repl{input: &plainReader{reader: bufio.NewReader(strings.NewReader(input))}}
+	done := make(chan int)
+	go func() { done <- repl.Run() }()
+	process, _ := os.FindProcess(os.Getpid())
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case status := <-done:
+			if status != EXIT_OK {
+				t.Errorf("exit status %d", status)
+			}
+			if s.out.String() != "1.000000\n" {
+				t.Errorf("got output %q", s.out.String())
+			}
+			if !strings.Contains(s.errOut.String(), "Execution stopped: context canceled.") {
+				t.Errorf("got diagnostics %q", s.errOut.String())
+			}
+			return
+		case <-ticker.C:
+			process.Signal(os.Interrupt)
+		case <-timeout:
+			t.Fatal("the loop was not interrupted")
+		}
+	}
+}
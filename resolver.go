@@ -1,12 +1,30 @@
 package main
 
+type functionType int8
+
+const (
+	FT_NONE = iota
+	FT_FUNCTION
+	FT_GENERATOR
+)
+
+// scope maps the names declared in a local scope to their variables.
+type scope map[string]variable
+
+type variable struct {
+	// slot is the position of the variable in its Environment
+	slot    int
+	defined bool
+}
+
 type Resolver struct {
-	interpreter *Interpreter
-	scopes      *Stack
+	interpreter     *Interpreter
+	scopes          *Stack
+	currentFunction functionType
 }
 
 func NewResolver(interpreter *Interpreter) *Resolver {
-	return &Resolver{interpreter: interpreter, scopes: NewStack()}
+	return &Resolver{interpreter: interpreter, scopes: NewStack(), currentFunction: FT_NONE}
 }
 
 func (r *Resolver) Resolve(statements []Statement) Any {
@@ -36,15 +54,17 @@ func (r *Resolver) visitUnaryExpr(expr UnaryExpression) Any {
 	return nil
 }
 
-func (r *Resolver) visitVarExpr(expr VariableExpression) Any {
-	if !r.scopes.IsEmpty() && r.scopes.Peek()[expr.Name.Lexeme] == false {
-		parseFault(expr.Name, "Can't read local variable in its own initializer.")
+func (r *Resolver) visitVarExpr(expr *VariableExpression) Any {
+	if !r.scopes.IsEmpty() {
+		if v, ok := r.scopes.Peek()[expr.Name.Lexeme]; ok && !v.defined {
+			parseFault(expr.Name, "Can't read local variable in its own initializer.")
+		}
 	}
 	r.resolveLocal(expr, expr.Name)
 	return nil
 }
 
-func (r *Resolver) visitAssignExpr(expr AssignExpression) Any {
+func (r *Resolver) visitAssignExpr(expr *AssignExpression) Any {
 	r.resolveExpr(expr.Value)
 	r.resolveLocal(expr, expr.Name)
 	return nil
@@ -58,6 +78,31 @@ func (r *Resolver) visitCallExpr(expr CallExpression) Any {
 	return nil
 }
 
+func (r *Resolver) visitListExpr(expr ListExpression) Any {
+	for _, element := range expr.Elements {
+		r.resolveExpr(element)
+	}
+	return nil
+}
+
+func (r *Resolver) visitMapExpr(expr MapExpression) Any {
+	for n := range expr.Keys {
+		r.resolveExpr(expr.Keys[n])
+		r.resolveExpr(expr.Values[n])
+	}
+	return nil
+}
+
+func (r *Resolver) visitRangeExpr(expr RangeExpression) Any {
+	r.resolveExpr(expr.Start)
+	r.resolveExpr(expr.End)
+	return nil
+}
+
+func (r *Resolver) visitErrorExpr(expr ErrorExpression) Any {
+	return nil
+}
+
 func (r *Resolver) resolveExpr(expr Expression) Any {
 	expr.Accept(r)
 	return nil
@@ -106,6 +151,18 @@ func (r *Resolver) visitWhileStmt(stmt WhileStatement) Any {
 	return nil
 }
 
+func (r *Resolver) visitForInStmt(stmt ForInStatement) Any {
+	r.resolveExpr(stmt.Iterable)
+	r.beginScope()
+	for _, variable := range stmt.Variables {
+		r.declare(variable)
+		r.define(variable)
+	}
+	r.resolveStmt(stmt.Body)
+	r.endScope()
+	return nil
+}
+
 func (r *Resolver) visitFunctionStmt(stmt FunctionStatement) Any {
 	r.declare(stmt.Name)
 	r.define(stmt.Name)
@@ -115,12 +172,109 @@ func (r *Resolver) visitFunctionStmt(stmt FunctionStatement) Any {
 }
 
 func (r *Resolver) visitReturnStmt(stmt ReturnStatement) Any {
+	if r.currentFunction == FT_NONE {
+		parseFault(stmt.Keyword, "Can't return from top-level code.")
+	}
 	if stmt.Value != nil {
+		if r.currentFunction == FT_GENERATOR {
+			parseFault(stmt.Keyword, "Can't return a value from a generator.")
+		}
 		r.resolveExpr(stmt.Value)
 	}
 	return nil
 }
 
+func (r *Resolver) visitYieldStmt(stmt YieldStatement) Any {
+	if r.currentFunction != FT_GENERATOR {
+		parseFault(stmt.Keyword, "Can't yield outside of a function.")
+	}
+	if stmt.Value != nil {
+		r.resolveExpr(stmt.Value)
+	}
+	return nil
+}
+
+func (r *Resolver) visitMatchStmt(stmt MatchStatement) Any {
+	r.resolveExpr(stmt.Subject)
+	hasDefault := false
+	for _, arm := range stmt.Arms {
+		r.beginScope()
+		for _, pattern := range arm.Patterns {
+			bound := len(r.scopes.Peek())
+			r.resolvePattern(pattern)
+			if len(arm.Patterns) > 1 && len(r.scopes.Peek()) != bound {
+				parseFault(arm.Arrow, "Can't bind variables in alternative patterns.")
+			}
+			if arm.Guard == nil && isIrrefutable(pattern) {
+				hasDefault = true
+			}
+		}
+		if arm.Guard != nil {
+			r.resolveExpr(arm.Guard)
+		}
+		r.resolveStmt(arm.Body)
+		r.endScope()
+	}
+	if !hasDefault {
+		warning(stmt.Keyword, "Match has no default arm.")
+	}
+	return nil
+}
+
+func (r *Resolver) visitWildcardPattern(pattern WildcardPattern) Any {
+	return nil
+}
+
+func (r *Resolver) visitLiteralPattern(pattern LiteralPattern) Any {
+	return nil
+}
+
+func (r *Resolver) visitBindingPattern(pattern BindingPattern) Any {
+	r.declare(pattern.Name)
+	r.define(pattern.Name)
+	return nil
+}
+
+func (r *Resolver) visitTypePattern(pattern TypePattern) Any {
+	if pattern.Name.TokenType == TT_IDENTIFIER {
+		r.declare(pattern.Name)
+		r.define(pattern.Name)
+	}
+	return nil
+}
+
+func (r *Resolver) visitListPattern(pattern ListPattern) Any {
+	for _, element := range pattern.Elements {
+		r.resolvePattern(element)
+	}
+	return nil
+}
+
+func (r *Resolver) visitMapPattern(pattern MapPattern) Any {
+	for _, value := range pattern.Values {
+		r.resolvePattern(value)
+	}
+	return nil
+}
+
+func (r *Resolver) resolvePattern(pattern Pattern) Any {
+	pattern.Accept(r)
+	return nil
+}
+
+// isIrrefutable reports whether pattern matches every possible value.
+func isIrrefutable(pattern Pattern) bool {
+	switch pattern.(type) {
+	case WildcardPattern, BindingPattern:
+		return true
+	}
+	return false
+}
+
+func (r *Resolver) visitErrorStmt(stmt ErrorStatement) Any {
+	return nil
+}
+
 func (r *Resolver) resolveStmt(stmt Statement) Any {
 	stmt.Accept(r)
 	return nil
@@ -128,8 +282,11 @@ func (r *Resolver) resolveStmt(stmt Statement) Any {
 
 func (r *Resolver) resolveLocal(expr Expression, name Token) Any {
 	for i := r.scopes.Len() - 1; i >= 0; i-- {
-		if _, ok := r.scopes.Get(i)[name.Lexeme]; ok {
-			r.interpreter.Resolve(expr, r.scopes.Len()-1-i)
+		if v, ok := r.scopes.Get(i)[name.Lexeme]; ok {
+			r.interpreter.Resolve(expr, r.scopes.Len()-1-i, v.slot)
+			if r.currentFunction == FT_NONE {
+				r.interpreter.scriptLocals = append(r.interpreter.scriptLocals, expr)
+			}
 			return nil
 		}
 	}
@@ -137,6 +294,15 @@ func (r *Resolver) resolveLocal(expr Expression, name Token) Any {
 }
 
 func (r *Resolver) resolveFunction(function FunctionStatement) Any {
+	enclosingFunction := r.currentFunction
+	r.currentFunction = FT_FUNCTION
+	if function.Generator {
+		r.currentFunction = FT_GENERATOR
+	}
+	defer func() {
+		r.currentFunction = enclosingFunction
+	}()
+
 	r.beginScope()
 	for _, param := range function.Params {
 		r.declare(param)
@@ -150,7 +316,7 @@ func (r *Resolver) resolveFunction(function FunctionStatement) Any {
 }
 
 func (r *Resolver) beginScope() {
-	r.scopes.Push(make(map[string]bool))
+	r.scopes.Push(make(scope))
 }
 
 func (r *Resolver) endScope() {
@@ -165,7 +331,7 @@ func (r *Resolver) declare(name Token) {
 	if _, ok := scope[name.Lexeme]; ok {
 		parseFault(name, "Already a variable with this name in this scope.")
 	}
-	scope[name.Lexeme] = false
+	scope[name.Lexeme] = variable{slot: len(scope), defined: false}
 }
 
 func (r *Resolver) define(name Token) {
@@ -173,5 +339,7 @@ func (r *Resolver) define(name Token) {
 		return
 	}
 	scope := r.scopes.Peek()
-	scope[name.Lexeme] = true
+	v := scope[name.Lexeme]
+	v.defined = true
+	scope[name.Lexeme] = v
 }
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestResolver_Slots(t *testing.T) {
+	source := "fun f(a, b) { var c = a; { var d = b; print c + d; } }"
+	stmts, errs := NewParser(NewScanner(source).ScanTokens()).Parse()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	interpreter := NewInterpreter()
+	NewResolver(interpreter).Resolve(stmts)
+
+	want := map[string]location{
+		"a": {depth: 0, slot: 0},
+		"b": {depth: 1, slot: 1},
+		"c": {depth: 1, slot: 2},
+		"d": {depth: 0, slot: 0},
+	}
+	if len(interpreter.locals) != len(want) {
+		t.Fatalf("resolved %d variables, want %d", len(interpreter.locals), len(want))
+	}
+	for expr, got := range interpreter.locals {
+		name := expr.(*VariableExpression).Name.Lexeme
+		if got != want[name] {
+			t.Errorf("%s at %+v, want %+v", name, got, want[name])
+		}
+	}
+}
+
+// Neither engine runs a program that returns from top-level code.
+func TestResolver_TopLevelReturn(t *testing.T) {
+	source := "fun f() { print \"called\"; }\nreturn f();\n{ return; }"
+	want := "<test>:2:1: Error at 'return': Can't return from top-level code.\n" +
+		"    return f();\n" +
+		"    ^^^^^^\n" +
+		"<test>:3:3: Error at 'return': Can't return from top-level code.\n" +
+		"    { return; }\n" +
+		"      ^^^^^^\n"
+	for _, name := range []string{ENGINE_TREE, ENGINE_VM} {
+		t.Run(name, func(t *testing.T) {
+			s := newSession(t)
+			engine = name
+			run("<test>", source)
+			if got := s.out.String() + s.errOut.String(); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
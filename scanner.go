@@ -3,42 +3,100 @@ package main
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
+const byteOrderMark = '\uFEFF'
+
+// ScanError is a diagnostic about source text that could not be scanned.
+type ScanError struct {
+	Span    Span
+	Message string
+}
+
+func (e ScanError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Span.Line, e.Span.Column, e.Message)
+}
+
 type Scanner struct {
 	source string
 	tokens []Token
+	// doc collects /// comment lines until the next token is added
+	doc []string
 
 	start   int
 	current int
 	line    int
+	// lineStart is the offset of the first byte of the current line
+	lineStart int
+	// startLine and startColumn locate start
+	startLine   int
+	startColumn int
+	// unterminated is set when the source ends inside a string or block
+	// comment
+	unterminated bool
+	// report is called with the errors found, and reports them as faults
+	// unless replaced
+	report func(span Span, message string)
 }
 
 func NewScanner(source string) *Scanner {
-	return &Scanner{source: source, start: 0, current: 0, line: 1}
+	return &Scanner{source: source, start: 0, current: 0, line: 1, report: fault}
 }
 
 func (s *Scanner) ScanTokens() []Token {
+	s.skipShebang()
 	for !s.isAtEnd() {
-		s.start = s.current
+		s.markStart()
 		s.scanToken()
 	}
+	s.markStart()
 	s.addToken(TT_EOF, nil)
 	return s.tokens
 }
 
+// skipShebang skips a `#!` interpreter line at the very start of the source,
+// leaving its line break to be counted as usual.
+func (s *Scanner) skipShebang() {
+	if !strings.HasPrefix(s.source, "#!") {
+		return
+	}
+	for !s.isAtEnd() && s.peek() != '\n' {
+		s.advance()
+	}
+}
+
+func (s *Scanner) markStart() {
+	s.start = s.current
+	s.startLine = s.line
+	s.startColumn = utf8.RuneCountInString(s.source[s.lineStart:s.start]) + 1
+}
+
+// span returns the span of the text scanned since the last markStart.
+func (s *Scanner) span() Span {
+	return Span{Start: s.start, End: s.current, Line: s.startLine, Column: s.startColumn}
+}
+
 func (s *Scanner) isAtEnd() bool {
 	return s.current >= len(s.source)
 }
 
-func (s *Scanner) advance() byte {
-	var c = s.source[s.current]
-	s.current++
+func (s *Scanner) advance() rune {
+	c, size := utf8.DecodeRuneInString(s.source[s.current:])
+	s.current += size
+	if c == '\n' {
+		s.line++
+		s.lineStart = s.current
+	}
 	return c
 }
 
 func (s *Scanner) scanToken() {
-	var c byte = s.advance()
+	if s.invalidEncoding() {
+		return
+	}
+	var c rune = s.advance()
 	switch c {
 	case '(':
 		s.addToken(TT_LEFT_PAREN, nil)
@@ -48,8 +106,26 @@ func (s *Scanner) scanToken() {
 		s.addToken(TT_LEFT_BRACE, nil)
 	case '}':
 		s.addToken(TT_RIGHT_BRACE, nil)
+	case '[':
+		s.addToken(TT_LEFT_BRACKET, nil)
+	case ']':
+		s.addToken(TT_RIGHT_BRACKET, nil)
+	case ':':
+		s.addToken(TT_COLON, nil)
 	case ',':
 		s.addToken(TT_COMMA, nil)
+	case '.':
+		if s.isDigit(s.peek()) {
+			s.scanNumber()
+		} else if s.match('.') {
+			if s.match('<') {
+				s.addToken(TT_DOT_DOT_LESS, nil)
+			} else {
+				s.addToken(TT_DOT_DOT, nil)
+			}
+		} else {
+			s.addToken(TT_DOT, nil)
+		}
 	case '-':
 		s.addToken(TT_MINUS, nil)
 	case '+':
@@ -67,6 +143,8 @@ func (s *Scanner) scanToken() {
 	case '=':
 		if s.match('=') {
 			s.addToken(TT_EQUAL_EQUAL, nil)
+		} else if s.match('>') {
+			s.addToken(TT_ARROW, nil)
 		} else {
 			s.addToken(TT_EQUAL, nil)
 		}
@@ -84,9 +162,9 @@ func (s *Scanner) scanToken() {
 		}
 	case '/':
 		if s.match('/') {
-			for s.peek() != '\n' && !s.isAtEnd() {
-				s.advance()
-			}
+			s.scanLineComment()
+		} else if s.match('*') {
+			s.scanBlockComment()
 		} else {
 			s.addToken(TT_SLASH, nil)
 		}
@@ -97,41 +175,77 @@ func (s *Scanner) scanToken() {
 	case '\t':
 		//explicit ignore
 	case '\n':
-		s.line++
+		//explicit ignore, advance counts lines
 	case '"':
 		s.scanString()
+	case byteOrderMark:
+		s.report(s.span(), "Unexpected byte order mark; source must be UTF-8 without a BOM.")
 	default:
 		if s.isDigit(c) {
 			s.scanNumber()
 		} else if s.isAlpha(c) {
 			s.scanIdentifier()
 		} else {
-			fault(s.line, "Unexpected character")
+			s.report(s.span(), fmt.Sprintf("Unexpected character %q.", c))
 		}
 	}
 }
 
-func (s *Scanner) peek() byte {
+// invalidEncoding reports, and skips, a run of bytes at the current position
+// that are not valid UTF-8.
+func (s *Scanner) invalidEncoding() bool {
+	if !s.atInvalidByte() {
+		return false
+	}
+	if s.current == 0 && (s.hasPrefix("\xff\xfe") || s.hasPrefix("\xfe\xff")) {
+		s.report(s.span(), "Source is UTF-16 encoded; expected UTF-8.")
+		s.current = len(s.source)
+		return true
+	}
+	for s.atInvalidByte() {
+		s.current++
+	}
+	s.report(s.span(), "Invalid UTF-8 encoding.")
+	return true
+}
+
+func (s *Scanner) atInvalidByte() bool {
+	c, size := utf8.DecodeRuneInString(s.source[s.current:])
+	return c == utf8.RuneError && size == 1
+}
+
+func (s *Scanner) hasPrefix(prefix string) bool {
+	return len(s.source) >= len(prefix) && s.source[:len(prefix)] == prefix
+}
+
+func (s *Scanner) peek() rune {
 	if s.isAtEnd() {
 		//null character
 		return '\000'
 	}
-	return s.source[s.current]
+	c, _ := utf8.DecodeRuneInString(s.source[s.current:])
+	return c
 }
 
-func (s *Scanner) peekNext() byte {
-	if s.current+1 >= len(s.source) {
+func (s *Scanner) peekNext() rune {
+	if s.isAtEnd() {
+		//null character
+		return '\000'
+	}
+	_, size := utf8.DecodeRuneInString(s.source[s.current:])
+	if s.current+size >= len(s.source) {
 		//null character
 		return '\000'
 	}
-	return s.source[s.current+1]
+	c, _ := utf8.DecodeRuneInString(s.source[s.current+size:])
+	return c
 }
 
-func (s *Scanner) match(r byte) bool {
+func (s *Scanner) match(r rune) bool {
 	if s.isAtEnd() {
 		return false
 	}
-	if s.source[s.current] != r {
+	if s.peek() != r {
 		return false
 	}
 	_ = s.advance()
@@ -143,35 +257,82 @@ func (s *Scanner) addToken(tokenType TokenType, literal interface{}) {
 	if tokenType == TT_EOF {
 		text = ""
 	}
+	var doc string
+	if tokenType == TT_FUN || tokenType == TT_VAR {
+		doc = strings.Join(s.doc, "\n")
+	}
 	s.tokens = append(s.tokens, Token{
 		TokenType: tokenType,
 		Lexeme:    string(text),
 		Literal:   literal,
-		Line:      s.line,
+		Line:      s.startLine,
+		Column:    s.startColumn,
+		Start:     s.start,
+		End:       s.current,
+		Doc:       doc,
 	})
+	s.doc = nil
+}
+
+// scanLineComment skips a // comment. Comments starting with exactly three
+// slashes are doc comments and are kept for the next token, which keeps
+// them only if it starts a declaration.
+func (s *Scanner) scanLineComment() {
+	for s.peek() != '\n' && !s.isAtEnd() {
+		s.advance()
+	}
+	var text = s.source[s.start:s.current]
+	if strings.HasPrefix(text, "///") && !strings.HasPrefix(text, "////") {
+		text = strings.TrimPrefix(text[3:], " ")
+		s.doc = append(s.doc, strings.TrimRight(text, "\r"))
+	}
 }
 
-func (s *Scanner) isDigit(c byte) bool {
+// scanBlockComment skips a /* */ comment. Block comments nest, so that code
+// containing comments can itself be commented out.
+func (s *Scanner) scanBlockComment() {
+	depth := 1
+	for depth > 0 {
+		if s.isAtEnd() {
+			s.unterminated = true
+			s.report(s.span(), "Unterminated block comment.")
+			return
+		}
+		if s.peek() == '/' && s.peekNext() == '*' {
+			s.advance()
+			depth++
+		} else if s.peek() == '*' && s.peekNext() == '/' {
+			s.advance()
+			depth--
+		}
+		s.advance()
+	}
+}
+
+func (s *Scanner) isDigit(c rune) bool {
 	return c >= '0' && c <= '9'
 }
 
-func (s *Scanner) isAlpha(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+func (s *Scanner) isAlpha(c rune) bool {
+	return c == '_' || isXIDStart(c)
 }
 
-func (s *Scanner) isAlphaNumeric(c byte) bool {
-	return s.isAlpha(c) || s.isDigit(c)
+func (s *Scanner) isAlphaNumeric(c rune) bool {
+	return isXIDContinue(c)
 }
 
 func (s *Scanner) scanString() {
 	for s.peek() != '"' && !s.isAtEnd() {
-		if s.peek() == '\n' {
-			s.line++
+		if s.invalidEncoding() {
+			continue
 		}
 		_ = s.advance()
 	}
 	if s.isAtEnd() {
-		fault(s.line, "Unterminated string.")
+		s.unterminated = true
+		s.report(s.span(), "Unterminated string.")
+		s.addToken(TT_STRING, s.source[s.start+1:s.current])
+		return
 	}
 	//closing "
 	_ = s.advance()
@@ -179,35 +340,162 @@ func (s *Scanner) scanString() {
 	s.addToken(TT_STRING, value)
 }
 
+var radixNames = map[int]string{2: "binary", 8: "octal", 10: "decimal", 16: "hexadecimal"}
+
+// scanNumber scans a number literal whose first character, a digit or the
+// '.' of a leading-dot fraction, has already been consumed. Besides decimal
+// literals with an optional fraction and exponent it accepts the prefixes
+// 0x, 0o and 0b, and '_' separators between digits.
 func (s *Scanner) scanNumber() {
-	for s.isDigit(s.peek()) {
-		_ = s.advance()
+	first := s.source[s.start]
+	if first == '0' {
+		switch s.peek() {
+		case 'x', 'X':
+			s.scanRadixNumber(16)
+			return
+		case 'o', 'O':
+			s.scanRadixNumber(8)
+			return
+		case 'b', 'B':
+			s.scanRadixNumber(2)
+			return
+		}
 	}
-	if s.peek() == '.' && s.isDigit(s.peekNext()) {
-		//consume '.'
-		_ = s.advance()
+	if first != '.' {
+		if _, ok := s.scanDigits(10, 1); !ok {
+			s.numberFault("")
+			return
+		}
+		if s.peek() == '.' && s.isDigit(s.peekNext()) {
+			//consume '.'
+			_ = s.advance()
+			first = '.'
+		}
+	}
+	if first == '.' {
 		//parse fractional
-		for s.isDigit(s.peek()) {
+		if _, ok := s.scanDigits(10, 0); !ok {
+			s.numberFault("")
+			return
+		}
+	}
+	if s.peek() == 'e' || s.peek() == 'E' {
+		_ = s.advance()
+		if s.peek() == '+' || s.peek() == '-' {
 			_ = s.advance()
 		}
+		count, ok := s.scanDigits(10, 0)
+		if !ok {
+			s.numberFault("")
+			return
+		}
+		if count == 0 {
+			s.numberFault("Exponent has no digits.")
+			return
+		}
 	}
-	var value, err = strconv.ParseFloat(s.source[s.start:s.current], 32)
+	if s.isAlphaNumeric(s.peek()) {
+		s.numberFault(fmt.Sprintf("Unexpected character %q in number literal.", s.peek()))
+		return
+	}
+	var text = strings.ReplaceAll(s.source[s.start:s.current], "_", "")
+	var value, err = strconv.ParseFloat(text, 64)
 	if err != nil {
-		//this should never happen
-		panic(fmt.Errorf("failed to scan number: %s", err))
+		s.numberFault("Number literal is out of range.")
+		return
 	}
 	s.addToken(TT_NUMBER, value)
 }
 
+func (s *Scanner) scanRadixNumber(radix int) {
+	//consume prefix letter
+	_ = s.advance()
+	prefixEnd := s.current
+	count, ok := s.scanDigits(radix, 0)
+	if !ok {
+		s.numberFault("")
+		return
+	}
+	if s.isAlphaNumeric(s.peek()) {
+		s.numberFault(fmt.Sprintf("Invalid digit %q in %s literal.", s.peek(), radixNames[radix]))
+		return
+	}
+	if count == 0 {
+		s.numberFault(fmt.Sprintf("Expect %s digits after '%s'.", radixNames[radix], s.source[s.start:prefixEnd]))
+		return
+	}
+	var value float64 = 0
+	for _, c := range s.source[prefixEnd:s.current] {
+		if c != '_' {
+			value = value*float64(radix) + float64(digitValue(c))
+		}
+	}
+	s.addToken(TT_NUMBER, value)
+}
+
+// scanDigits consumes digits of the given radix and the '_' separators
+// between them. seen is the number of digits already consumed by the caller.
+// It returns the number of digits, or false after reporting a separator that
+// is not between two digits.
+func (s *Scanner) scanDigits(radix int, seen int) (int, bool) {
+	count := seen
+	for {
+		c := s.peek()
+		if c == '_' {
+			if count == 0 || digitValue(s.peekNext()) >= radix {
+				s.report(s.span(), "'_' must separate successive digits.")
+				return count, false
+			}
+			_ = s.advance()
+			continue
+		}
+		if digitValue(c) >= radix {
+			return count, true
+		}
+		_ = s.advance()
+		count++
+	}
+}
+
+// numberFault reports a malformed number literal, unless message is empty
+// because the problem has already been reported, and consumes the rest of
+// the literal so that it is not rescanned as further tokens.
+func (s *Scanner) numberFault(message string) {
+	if message != "" {
+		s.report(s.span(), message)
+	}
+	for s.isAlphaNumeric(s.peek()) || (s.peek() == '.' && s.isDigit(s.peekNext())) {
+		_ = s.advance()
+	}
+	s.addToken(TT_NUMBER, 0.0)
+}
+
+// digitValue returns the value of c as a digit in bases up to 16, or 16 if c
+// is not a digit.
+func digitValue(c rune) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return 16
+}
+
 func (s *Scanner) scanIdentifier() {
 	// by having the scan path isAlpha but the loop isAlphaNumeric,
-	// identifiers are restricted to starting with an alpha character
+	// identifiers are restricted to starting with a letter or underscore
 	for s.isAlphaNumeric(s.peek()) {
 		_ = s.advance()
 	}
 
 	var text = s.source[s.start:s.current]
 	var t_type = keywords[text]
+	if text == "_" {
+		t_type = TT_UNDERSCORE
+	}
 	if t_type == TT_NO_TOKEN {
 		t_type = TT_IDENTIFIER
 	}
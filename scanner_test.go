@@ -0,0 +1,202 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func scanTypes(source string) []TokenType {
+	var types []TokenType
+	for _, token := range NewScanner(source).ScanTokens() {
+		types = append(types, token.TokenType)
+	}
+	return types
+}
+
+func TestScanner_Identifiers(t *testing.T) {
+	for _, source := range []string{"my_var", "_private", "größe", "日本", "x1"} {
+		tokens := NewScanner(source).ScanTokens()
+		if len(tokens) != 2 || tokens[0].TokenType != TT_IDENTIFIER || tokens[0].Lexeme != source {
+			t.Errorf("%q scanned as %v", source, tokens)
+		}
+	}
+}
+
+func TestScanner_Wildcard(t *testing.T) {
+	types := scanTypes("_ __")
+	if types[0] != TT_UNDERSCORE || types[1] != TT_IDENTIFIER {
+		t.Errorf("got %v", types)
+	}
+}
+
+func TestScanner_XIDExclusions(t *testing.T) {
+	if isXIDStart('ͺ') || isXIDContinue('ͺ') {
+		t.Error("U+037A is not XID")
+	}
+	if isXIDStart('ำ') || !isXIDContinue('ำ') {
+		t.Error("U+0E33 is XID_Continue only")
+	}
+	if isXIDStart('1') || !isXIDContinue('1') {
+		t.Error("digits only continue identifiers")
+	}
+}
+
+// scanDiagnostics scans source and returns the first line of each
+// diagnostic it reports.
+func scanDiagnostics(t *testing.T, source string) []string {
+	s := newSession(t)
+	currentSource = NewSource("<test>", source)
+	NewScanner(source).ScanTokens()
+	var diagnostics []string
+	for _, line := range strings.Split(s.errOut.String(), "\n") {
+		if strings.HasPrefix(line, "<test>:") {
+			diagnostics = append(diagnostics, line)
+		}
+	}
+	return diagnostics
+}
+
+func TestScanner_Encoding(t *testing.T) {
+	cases := map[string][]string{
+		"print 1;\nprint \xfe\xfe;": {
+			"<test>:2:7: Error: Invalid UTF-8 encoding.",
+		},
+		"x\xff y \xc3": {
+			"<test>:1:2: Error: Invalid UTF-8 encoding.",
+			"<test>:1:6: Error: Invalid UTF-8 encoding.",
+		},
+		"\xff\xfep\x00": {
+			"<test>:1:1: Error: Source is UTF-16 encoded; expected UTF-8.",
+		},
+		"\uFEFFprint 1;": {
+			"<test>:1:1: Error: Unexpected byte order mark; source must be UTF-8 without a BOM.",
+		},
+		"print 1;\n  \uFEFF": {
+			"<test>:2:3: Error: Unexpected byte order mark; source must be UTF-8 without a BOM.",
+		},
+	}
+	for source, want := range cases {
+		if got := scanDiagnostics(t, source); !slices.Equal(got, want) {
+			t.Errorf("%q\n got: %q\nwant: %q", source, got, want)
+		}
+	}
+}
+
+func TestScanner_UnterminatedString(t *testing.T) {
+	cases := map[string]string{
+		"print 1;\n\"": "",
+		"\"abc":        "abc",
+	}
+	for source, want := range cases {
+		if got := scanDiagnostics(t, source); len(got) != 1 || !strings.HasSuffix(got[0], "Error: Unterminated string.") {
+			t.Errorf("%q: got %q", source, got)
+		}
+		tokens := NewScanner(source).ScanTokens()
+		last := tokens[len(tokens)-2]
+		if last.TokenType != TT_STRING || last.Literal != want {
+			t.Errorf("%q scanned as %v, want %q", source, tokens, want)
+		}
+	}
+}
+
+func TestScanner_NumberLiterals(t *testing.T) {
+	cases := map[string]float64{
+		"42":        42,
+		"0xFF":      255,
+		"0b1010":    10,
+		"0o17":      15,
+		"1.5e-3":    0.0015,
+		"2E2":       200,
+		"1_000_000": 1000000,
+		".25":       0.25,
+		"0.1":       0.1,
+	}
+	for source, want := range cases {
+		tokens := NewScanner(source).ScanTokens()
+		if len(tokens) != 2 || tokens[0].TokenType != TT_NUMBER || tokens[0].Literal != want {
+			t.Errorf("%q scanned as %v, want %v", source, tokens, want)
+		}
+	}
+}
+
+func TestScanner_MalformedNumbers(t *testing.T) {
+	for _, source := range []string{"0x", "0b102", "1e", "1e+", "1__0", "1_", "0o8", "12ab"} {
+		hadError = false
+		tokens := NewScanner(source).ScanTokens()
+		if !hadError || len(tokens) != 2 {
+			t.Errorf("%q: expected a single error token, got %v", source, tokens)
+		}
+	}
+	hadError = false
+}
+
+func TestScanner_RangeAfterNumber(t *testing.T) {
+	types := scanTypes("0..10")
+	if len(types) != 4 || types[0] != TT_NUMBER || types[1] != TT_DOT_DOT || types[2] != TT_NUMBER {
+		t.Errorf("got %v", types)
+	}
+}
+
+func TestScanner_BlockComments(t *testing.T) {
+	types := scanTypes("1 /* a /* nested */ still comment */ 2")
+	if len(types) != 3 || types[0] != TT_NUMBER || types[1] != TT_NUMBER {
+		t.Errorf("got %v", types)
+	}
+	tokens := NewScanner("/* one\ntwo */ x").ScanTokens()
+	if tokens[0].Line != 2 {
+		t.Errorf("line %d after multi-line comment", tokens[0].Line)
+	}
+	hadError = false
+	NewScanner("/* /* */").ScanTokens()
+	if !hadError {
+		t.Error("unterminated block comment not reported")
+	}
+	hadError = false
+}
+
+func TestScanner_DocComments(t *testing.T) {
+	tokens := NewScanner("/// Adds one.\n///  Really.\n//// not doc\nfun f() {}").ScanTokens()
+	if tokens[0].TokenType != TT_FUN || tokens[0].Doc != "Adds one.\n Really." {
+		t.Errorf("got doc %q on %v", tokens[0].Doc, tokens[0])
+	}
+	if tokens[1].Doc != "" {
+		t.Error("doc comment attached to more than one token")
+	}
+	tokens = NewScanner("/// Not a declaration.\nprint 1;\nvar x;").ScanTokens()
+	for _, token := range tokens {
+		if token.Doc != "" {
+			t.Errorf("doc comment attached to %v", token)
+		}
+	}
+	tokens = NewScanner("/// The answer.\nvar x = 42;").ScanTokens()
+	if tokens[0].TokenType != TT_VAR || tokens[0].Doc != "The answer." {
+		t.Errorf("got doc %q on %v", tokens[0].Doc, tokens[0])
+	}
+}
+
+func TestScanner_TokenNames(t *testing.T) {
+	tokens := NewScanner("var x = \"hi\";").ScanTokens()
+	want := "1:1   VAR         \"var\"\n" +
+		"1:5   IDENTIFIER  \"x\"\n" +
+		"1:7   EQUAL       \"=\"\n" +
+		"1:9   STRING      \"\\\"hi\\\"\"  \"hi\"\n" +
+		"1:13  SEMICOLON   \";\"\n" +
+		"1:14  EOF         \"\"\n"
+	if got := tokensText(tokens); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if got := tokens[0].String(); got != "VAR var" {
+		t.Errorf("got %q", got)
+	}
+	if got := TokenType(100).String(); got != "TokenType(100)" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestScanner_Shebang(t *testing.T) {
+	tokens := NewScanner("#!/usr/bin/env gs\nprint 1;").ScanTokens()
+	if tokens[0].TokenType != TT_PRINT || tokens[0].Line != 2 || tokens[0].Column != 1 {
+		t.Errorf("got %v at %d:%d", tokens[0].TokenType, tokens[0].Line, tokens[0].Column)
+	}
+}
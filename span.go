@@ -0,0 +1,47 @@
+package main
+
+// Span is a range of source text. Start and End are byte offsets with End
+// exclusive; Line and Column locate Start, with columns counted in runes.
+// Lines and columns are 1-based, so the zero Span means "no position".
+type Span struct {
+	Start  int
+	End    int
+	Line   int
+	Column int
+}
+
+func (s Span) IsValid() bool {
+	return s.Line > 0
+}
+
+// To returns the span running from the start of s to the end of other.
+// Invalid spans are ignored so that optional parts of a node can be joined
+// without checking for them first.
+func (s Span) To(other Span) Span {
+	if !s.IsValid() {
+		return other
+	}
+	if !other.IsValid() || other.End < s.End {
+		return s
+	}
+	s.End = other.End
+	return s
+}
+
+func (t Token) Span() Span {
+	return Span{Start: t.Start, End: t.End, Line: t.Line, Column: t.Column}
+}
+
+func expressionSpan(expr Expression) Span {
+	if expr == nil {
+		return Span{}
+	}
+	return expr.Span()
+}
+
+func statementSpan(stmt Statement) Span {
+	if stmt == nil {
+		return Span{}
+	}
+	return stmt.Span()
+}
@@ -12,24 +12,24 @@ func NewStack() *Stack {
 	return &Stack{list.New()}
 }
 
-func (s *Stack) Push(x map[string]bool) {
+func (s *Stack) Push(x scope) {
 	s.list.PushBack(x)
 }
 
-func (s *Stack) Pop() map[string]bool {
+func (s *Stack) Pop() scope {
 	if s.list.Len() == 0 {
 		return nil
 	}
 	tail := s.list.Back()
 	val := tail.Value
 	s.list.Remove(tail)
-	return val.(map[string]bool)
+	return val.(scope)
 }
 
-func (s *Stack) Peek() map[string]bool {
+func (s *Stack) Peek() scope {
 	tail := s.list.Back()
 	val := tail.Value
-	return val.(map[string]bool)
+	return val.(scope)
 }
 
 func (s *Stack) IsEmpty() bool {
@@ -40,10 +40,10 @@ func (s *Stack) Len() int {
 	return s.list.Len()
 }
 
-func (s *Stack) Get(pos int) map[string]bool {
+func (s *Stack) Get(pos int) scope {
 	var it *list.Element = s.list.Front()
 	for i := 0; i < pos; i++ {
 		it = it.Next()
 	}
-	return it.Value.(map[string]bool)
+	return it.Value.(scope)
 }
@@ -4,7 +4,7 @@ import "testing"
 
 func TestStack_Peek(t *testing.T) {
 	stack := NewStack()
-	stack.Push(make(map[string]bool))
+	stack.Push(make(scope))
 	if stack.Peek() == nil {
 		t.Fail()
 	}
@@ -15,8 +15,8 @@ func TestStack_Peek(t *testing.T) {
 
 func TestStack_Pop(t *testing.T) {
 	stack := NewStack()
-	stack.Push(make(map[string]bool))
-	stack.Push(make(map[string]bool))
+	stack.Push(make(scope))
+	stack.Push(make(scope))
 	if stack.Pop() == nil {
 		t.Fail()
 	}
@@ -33,11 +33,11 @@ func TestStack_Pop(t *testing.T) {
 
 func TestStack_Get(t *testing.T) {
 	stack := NewStack()
-	m := make(map[string]bool)
-	m["abc"] = true
-	stack.Push(make(map[string]bool))
+	m := make(scope)
+	m["abc"] = variable{defined: true}
+	stack.Push(make(scope))
 	stack.Push(m)
-	stack.Push(make(map[string]bool))
+	stack.Push(make(scope))
 	m2 := stack.Get(1)
 	if _, ok := m2["abc"]; ok == false {
 		t.Fail()
@@ -2,6 +2,7 @@ package main
 
 type Statement interface {
 	Accept(visitor StatementVisitor) Any
+	Span() Span
 }
 
 type StatementVisitor interface {
@@ -13,42 +14,72 @@ type StatementVisitor interface {
 	visitWhileStmt(stmt WhileStatement) Any
 	visitFunctionStmt(stmt FunctionStatement) Any
 	visitReturnStmt(stmt ReturnStatement) Any
+	visitMatchStmt(stmt MatchStatement) Any
+	visitForInStmt(stmt ForInStatement) Any
+	visitYieldStmt(stmt YieldStatement) Any
+	visitErrorStmt(stmt ErrorStatement) Any
 }
 
 type PrintStatement struct {
+	Keyword    Token
 	Expression Expression
+	Semicolon  Token
 }
 
 func (p PrintStatement) Accept(visitor StatementVisitor) Any {
 	return visitor.visitPrintStmt(p)
 }
 
+func (p PrintStatement) Span() Span {
+	return p.Keyword.Span().To(p.Semicolon.Span())
+}
+
 type ExpressionStatement struct {
 	Expression Expression
+	Semicolon  Token
 }
 
 func (e ExpressionStatement) Accept(visitor StatementVisitor) Any {
 	return visitor.visitExprStmt(e)
 }
 
+func (e ExpressionStatement) Span() Span {
+	return expressionSpan(e.Expression).To(e.Semicolon.Span())
+}
+
 type VarStatement struct {
+	Keyword     Token
 	Name        Token
 	Initializer Expression
+	// Doc is the doc comment preceding the declaration.
+	Doc       string
+	Semicolon Token
 }
 
 func (e VarStatement) Accept(visitor StatementVisitor) Any {
 	return visitor.visitVarStmt(e)
 }
 
+func (e VarStatement) Span() Span {
+	return e.Keyword.Span().To(e.Semicolon.Span())
+}
+
 type BlockStatement struct {
+	LeftBrace  Token
 	Statements []Statement
+	RightBrace Token
 }
 
 func (e BlockStatement) Accept(visitor StatementVisitor) Any {
 	return visitor.visitBlockStmt(e)
 }
 
+func (e BlockStatement) Span() Span {
+	return e.LeftBrace.Span().To(e.RightBrace.Span())
+}
+
 type IfStatement struct {
+	Keyword   Token
 	Condition Expression
 	ThenBlock Statement
 	ElseBlock Statement
@@ -58,7 +89,12 @@ func (b IfStatement) Accept(visitor StatementVisitor) Any {
 	return visitor.visitIfStmt(b)
 }
 
+func (b IfStatement) Span() Span {
+	return b.Keyword.Span().To(statementSpan(b.ThenBlock)).To(statementSpan(b.ElseBlock))
+}
+
 type WhileStatement struct {
+	Keyword   Token
 	Condition Expression
 	Body      Statement
 }
@@ -67,21 +103,120 @@ func (b WhileStatement) Accept(visitor StatementVisitor) Any {
 	return visitor.visitWhileStmt(b)
 }
 
+func (b WhileStatement) Span() Span {
+	return b.Keyword.Span().To(statementSpan(b.Body))
+}
+
+// ForInStatement is `for (x in iterable) body` or, binding both the key and
+// the value of every element, `for (k, v in iterable) body`.
+type ForInStatement struct {
+	Keyword   Token
+	Variables []Token
+	In        Token
+	Iterable  Expression
+	Body      Statement
+}
+
+func (b ForInStatement) Accept(visitor StatementVisitor) Any {
+	return visitor.visitForInStmt(b)
+}
+
+func (b ForInStatement) Span() Span {
+	return b.Keyword.Span().To(statementSpan(b.Body))
+}
+
 type FunctionStatement struct {
-	Name   Token
-	Params []Token
-	Body   []Statement
+	Keyword    Token
+	Name       Token
+	Params     []Token
+	Body       []Statement
+	RightBrace Token
+	// Generator is set when the body contains a yield statement.
+	Generator bool
+	// Doc is the doc comment preceding the declaration.
+	Doc string
 }
 
 func (b FunctionStatement) Accept(visitor StatementVisitor) Any {
 	return visitor.visitFunctionStmt(b)
 }
 
+func (b FunctionStatement) Span() Span {
+	return b.Keyword.Span().To(b.RightBrace.Span())
+}
+
 type ReturnStatement struct {
-	Keyword Token
-	Value   Expression
+	Keyword   Token
+	Value     Expression
+	Semicolon Token
 }
 
 func (b ReturnStatement) Accept(visitor StatementVisitor) Any {
 	return visitor.visitReturnStmt(b)
 }
+
+func (b ReturnStatement) Span() Span {
+	return b.Keyword.Span().To(b.Semicolon.Span())
+}
+
+type MatchStatement struct {
+	Keyword    Token
+	Subject    Expression
+	Arms       []MatchArm
+	RightBrace Token
+}
+
+func (b MatchStatement) Accept(visitor StatementVisitor) Any {
+	return visitor.visitMatchStmt(b)
+}
+
+func (b MatchStatement) Span() Span {
+	return b.Keyword.Span().To(b.RightBrace.Span())
+}
+
+// MatchArm is a single `patterns [if guard] => body` case of a match
+// statement. The arm is taken when any of its patterns matches the subject
+// and the guard, if present, is truthy.
+type MatchArm struct {
+	Patterns []Pattern
+	Guard    Expression
+	Arrow    Token
+	Body     Statement
+}
+
+type YieldStatement struct {
+	Keyword   Token
+	Value     Expression
+	Semicolon Token
+}
+
+func (b YieldStatement) Accept(visitor StatementVisitor) Any {
+	return visitor.visitYieldStmt(b)
+}
+
+func (b YieldStatement) Span() Span {
+	return b.Keyword.Span().To(b.Semicolon.Span())
+}
+
+func (a MatchArm) Span() Span {
+	var span Span
+	if len(a.Patterns) > 0 {
+		span = a.Patterns[0].Span()
+	}
+	return span.To(statementSpan(a.Body))
+}
+
+// ErrorStatement stands in for a declaration that failed to parse and
+// covers the tokens the parser skipped to recover from it.
+type ErrorStatement struct {
+	From Token
+	To   Token
+}
+
+func (b ErrorStatement) Accept(visitor StatementVisitor) Any {
+	return visitor.visitErrorStmt(b)
+}
+
+func (b ErrorStatement) Span() Span {
+	return b.From.Span().To(b.To.Span())
+}
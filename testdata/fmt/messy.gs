@@ -0,0 +1,26 @@
+/// Adds one to count.
+fun plusOne( count ){var t=count+1;   return t;}
+// a standalone comment
+
+
+var start=-4 ;   // trailing comment
+if(start>0){print "positive";}else if (start == 0) print "zero";
+else{ print "negative" ; }
+var xs=[ 1,2 ,3 ];var m={ "a":1 , "b" : [ ] };
+for(k,v in m)print k;
+for (i in 0 ..< 10) {
+}
+match(xs){
+  [a,_,_] if a>0=>print a;
+  {"a" : n}, _: string => { print "map or string"; /* inline */ }
+  -1=>print !true;
+  _=>{}
+}
+fun gen ( ) { yield 1 ; yield ; }
+print plusOne(  plusOne(1) ) * (2 + /* two */ 3) - 4 / 2; // tail
+
+
+/* block
+   comment */
+print 1 + // continues
+  2;
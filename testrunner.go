@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+	Test runner
+
+	`gs test` runs scripts and checks what they print against comments in the
+	scripts themselves:
+
+	  print 1 + 2;    // expect: 3.000000
+	  var = 1;        // expect error: Expect variable name.
+	  match (1) {}    // expect warning: Match has no default arm.
+	  print nil + 1;  // expect runtime error: Operands must be numbers.
+	  exit(3);        // expect exit: 3
+
+	Each `expect:` is one line of output, in order. The diagnostic forms
+	expect a diagnostic on the line of the comment ending in the given
+	message, and the script to exit with the matching status unless `expect
+	exit:` gives another. Any output or diagnostic that is not expected fails
+	the test.
+*/
+
+var expectation = regexp.MustCompile(`//\s*expect( error| warning| runtime error| exit)?: ?(.*)$`)
+var diagnosticHeader = regexp.MustCompile(`^.*?:(\d+):\d+: (.*)$`)
+
+type diagnostic struct {
+	line    int
+	message string
+}
+
+// runTest implements `gs test [--engine=tree|vm] [--optimize] [files or
+// directories...]`, running the scripts in the tests directory if none are
+// given.
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.StringVar(&engine, "engine", engine, "`engine` to run with, tree or vm")
+	flags.BoolVar(&optimize, "optimize", optimize, "optimize the scripts before running them")
+	args, err := parseFlags(flags, args)
+	if err != nil || !validEngine() {
+		return EXIT_USAGE
+	}
+	if len(args) == 0 {
+		args = []string{"tests"}
+	}
+	var scripts []string
+	for _, arg := range args {
+		err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && (path == arg || filepath.Ext(path) == ".gs") {
+				scripts = append(scripts, path)
+			}
+			return err
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_NO_INPUT
+		}
+	}
+
+	failed := 0
+	for _, script := range scripts {
+		failures, err := testScript(script)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_NO_INPUT
+		}
+		if len(failures) == 0 {
+			fmt.Printf("PASS %s\n", script)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s\n", script)
+		for _, failure := range failures {
+			fmt.Printf("    %s\n", failure)
+		}
+	}
+	fmt.Printf("%d passed, %d failed\n", len(scripts)-failed, failed)
+	if failed > 0 {
+		return EXIT_TEST_FAILURE
+	}
+	return EXIT_OK
+}
+
+// testScript runs a script with a fresh interpreter and returns the ways in
+// which it did not behave as its comments expect.
+func testScript(path string) ([]string, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	source := string(bytes)
+
+	var output []string
+	var diagnostics []diagnostic
+	status := EXIT_OK
+	expectedExit := -1
+	for n, line := range strings.Split(source, "\n") {
+		match := expectation.FindStringSubmatch(line)
+		switch {
+		case match == nil:
+		case match[1] == "":
+			output = append(output, match[2])
+		case match[1] == " error":
+			diagnostics = append(diagnostics, diagnostic{n + 1, "Error: " + match[2]})
+			status = EXIT_USAGE
+		case match[1] == " warning":
+			diagnostics = append(diagnostics, diagnostic{n + 1, "Warning: " + match[2]})
+		case match[1] == " runtime error":
+			diagnostics = append(diagnostics, diagnostic{n + 1, "Runtime error: " + match[2]})
+			if status == EXIT_OK {
+				status = EXIT_SOFTWARE
+			}
+		case match[1] == " exit":
+			expectedExit, err = strconv.Atoi(match[2])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid exit status %q", path, n+1, match[2])
+			}
+		}
+	}
+	if expectedExit >= 0 {
+		status = expectedExit
+	}
+
+	gotOutput, gotDiagnostics, gotStatus := runIsolated(path, source)
+
+	var failures []string
+	for n := 0; n < max(len(output), len(gotOutput)); n++ {
+		switch {
+		case n >= len(gotOutput):
+			failures = append(failures, fmt.Sprintf("missing output %q", output[n]))
+		case n >= len(output):
+			failures = append(failures, fmt.Sprintf("unexpected output %q", gotOutput[n]))
+		case output[n] != gotOutput[n]:
+			failures = append(failures, fmt.Sprintf("expected output %q, got %q", output[n], gotOutput[n]))
+		}
+	}
+	for _, expected := range diagnostics {
+		found := false
+		for n, got := range gotDiagnostics {
+			if got.line == expected.line && diagnosticMatches(got.message, expected.message) {
+				gotDiagnostics = append(gotDiagnostics[:n], gotDiagnostics[n+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("missing diagnostic on line %d: %s", expected.line, expected.message))
+		}
+	}
+	for _, got := range gotDiagnostics {
+		failures = append(failures, fmt.Sprintf("unexpected diagnostic on line %d: %s", got.line, got.message))
+	}
+	if gotStatus != status {
+		failures = append(failures, fmt.Sprintf("expected exit status %d, got %d", status, gotStatus))
+	}
+	return failures, nil
+}
+
+// diagnosticMatches compares a reported diagnostic such as "Error at 'x':
+// message" with an expected one of the form "Error: message".
+func diagnosticMatches(got string, expected string) bool {
+	kind, message, _ := strings.Cut(expected, ": ")
+	return strings.HasPrefix(got, kind) && strings.HasSuffix(got, ": "+message)
+}
+
+// runIsolated runs a script with a fresh interpreter and returns the lines
+// it printed, the diagnostics it reported and its exit status.
+func runIsolated(name string, source string) ([]string, []diagnostic, int) {
+	var out, errOut strings.Builder
+	savedStdout, savedStderr, savedInterpreter := stdout, stderr, interpreter
+	defer func() {
+		stdout, stderr, interpreter = savedStdout, savedStderr, savedInterpreter
+		hadError, hadRuntimeError, exitCode = false, false, -1
+	}()
+	stdout, stderr = &out, &errOut
+	hadError, hadRuntimeError, exitCode = false, false, -1
+	interpreter = NewInterpreter()
+	defineArgs(nil)
+
+	run(name, source)
+
+	var lines []string
+	if out.Len() > 0 {
+		lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	}
+	var diagnostics []diagnostic
+	for _, line := range strings.Split(errOut.String(), "\n") {
+		// quoted source lines and carets are indented
+		if match := diagnosticHeader.FindStringSubmatch(line); match != nil && !strings.HasPrefix(line, " ") {
+			n, _ := strconv.Atoi(match[1])
+			diagnostics = append(diagnostics, diagnostic{n, match[2]})
+		}
+	}
+	return lines, diagnostics, exitStatus()
+}
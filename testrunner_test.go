@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestScripts(t *testing.T) {
+	scripts, err := filepath.Glob("tests/*.gs")
+	if err != nil || len(scripts) == 0 {
+		t.Fatalf("no test scripts: %v", err)
+	}
+	defer func(savedEngine string, savedOptimize bool) {
+		engine, optimize = savedEngine, savedOptimize
+	}(engine, optimize)
+	for _, engine = range []string{ENGINE_TREE, ENGINE_VM} {
+		for _, optimize = range []bool{false, true} {
+			name := engine
+			if optimize {
+				name += "+optimize"
+			}
+			for _, script := range scripts {
+				t.Run(name+"/"+filepath.Base(script), func(t *testing.T) {
+					failures, err := testScript(script)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, failure := range failures {
+						t.Error(failure)
+					}
+				})
+			}
+		}
+	}
+}
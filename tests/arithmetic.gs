@@ -0,0 +1,12 @@
+print 1 + 2; // expect: 3.000000
+print 7 - 2 * 3; // expect: 1.000000
+print (7 - 2) * 3; // expect: 15.000000
+print 9 / 4; // expect: 2.250000
+print -(1 + 1); // expect: -2.000000
+print 0x1F + 0b101; // expect: 36.000000
+print 1 < 2; // expect: true
+print 2 <= 1; // expect: false
+print 1 == 1; // expect: true
+print "a" == "a"; // expect: true
+print nil == false; // expect: false
+print "con" + "cat"; // expect: concat
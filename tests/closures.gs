@@ -0,0 +1,85 @@
+// Closures capture variables, not values, and every loop iteration and
+// match arm has variables of its own.
+fun makePair() {
+  var shared = 0;
+  fun add(n) {
+    shared = shared + n;
+    return shared;
+  }
+  fun get() {
+    return shared;
+  }
+  return [add, get];
+}
+var pair = makePair();
+for (f in pair) print f;
+// expect: <fn add>
+// expect: <fn get>
+var add = nil;
+var get = nil;
+match (pair) {
+  [a, g] => {
+    add = a;
+    get = g;
+  }
+  _ => print "no pair";
+}
+add(2);
+add(3);
+print get(); // expect: 5.000000
+
+fun shows() {
+  for (n in 1..3) {
+    fun show() {
+      print n;
+    }
+    yield show;
+  }
+}
+var next = shows();
+var first = next();
+var second = next();
+var third = next();
+third(); // expect: 3.000000
+second(); // expect: 2.000000
+first(); // expect: 1.000000
+
+fun outer() {
+  var x = "x";
+  fun middle() {
+    fun inner() {
+      return x;
+    }
+    return inner;
+  }
+  return middle();
+}
+print outer()(); // expect: x
+
+fun counter(limit) {
+  var n = 0;
+  fun next() {
+    if (n >= limit) return nil;
+    n = n + 1;
+    return n;
+  }
+  return next;
+}
+for (n in counter(2)) print n;
+// expect: 1.000000
+// expect: 2.000000
+
+fun small(values) {
+  for (v in values) {
+    match (v) {
+      n: number if n < 10 => yield n;
+      _ => nil;
+    }
+  }
+}
+for (n in small([1, 20, "x", 3])) print n;
+// expect: 1.000000
+// expect: 3.000000
+
+print !true; // expect: false
+print !nil; // expect: true
@@ -0,0 +1,18 @@
+var list = [1, "two", nil];
+print list; // expect: [1.000000, two, nil]
+var map = {"a": 1, "b": [true]};
+print map; // expect: {a: 1.000000, b: [true]}
+
+for (x in [1, 2]) print x;
+// expect: 1.000000
+// expect: 2.000000
+for (k, v in {"a": 1, "b": 2}) print [k, v];
+// expect: [a, 1.000000]
+// expect: [b, 2.000000]
+for (n in 1..3) print n;
+// expect: 1.000000
+// expect: 2.000000
+// expect: 3.000000
+for (c in "hé") print c;
+// expect: h
+// expect: é
@@ -0,0 +1,20 @@
+if (true) print "then"; else print "else"; // expect: then
+if (nil) print "then"; else print "else"; // expect: else
+
+var i = 0;
+while (i < 3) {
+  print i;
+  i = i + 1;
+}
+// expect: 0.000000
+// expect: 1.000000
+// expect: 2.000000
+
+fun firstOver(limit) {
+  var n = 0;
+  while (true) {
+    if (n > limit) return n;
+    n = n + 1;
+  }
+}
+print firstOver(4); // expect: 5.000000
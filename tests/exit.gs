@@ -0,0 +1,6 @@
+#!/usr/bin/env gs
+print "running"; // expect: running
+if (true) {
+  exit(3); // expect exit: 3
+}
+print "not reached";
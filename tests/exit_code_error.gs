@@ -0,0 +1 @@
+exit(1.5); // expect runtime error: Exit code must be an integer between 0 and 255.
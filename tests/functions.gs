@@ -0,0 +1,15 @@
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 1) + fib(n - 2);
+}
+print fib(15); // expect: 610.000000
+
+fun nothing() {}
+print nothing(); // expect: nil
+
+fun early() {
+  return;
+  print "unreachable";
+}
+print early(); // expect: nil
+print fib; // expect: <fn fib>
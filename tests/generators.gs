@@ -0,0 +1,16 @@
+fun countdown(n) {
+  while (n > 0) {
+    yield n;
+    n = n - 1;
+  }
+}
+
+for (n in countdown(3)) print n;
+// expect: 3.000000
+// expect: 2.000000
+// expect: 1.000000
+
+var next = countdown(2);
+print next(); // expect: 2.000000
+print next(); // expect: 1.000000
+print next(); // expect: nil
@@ -0,0 +1,20 @@
+fun describe(value) {
+  match (value) {
+    0 => return "zero";
+    n: number if n < 0 => return "negative";
+    [first, _] => return "pair starting with " + first;
+    {"name": name} => return "named " + name;
+    _: string => return "a string";
+    _ => return "something else";
+  }
+}
+print describe(0); // expect: zero
+print describe(-3); // expect: negative
+print describe(["x", 2]); // expect: pair starting with x
+print describe({"name": "ada"}); // expect: named ada
+print describe("hi"); // expect: a string
+print describe(true); // expect: something else
+
+match (1) { // expect warning: Match has no default arm.
+  2 => print "two";
+}
@@ -0,0 +1,3 @@
+// Scripts run sandboxed unless permissions are granted.
+print env; // expect: <native fn>
+env("HOME"); // expect runtime error: Requires env permission for "HOME".
@@ -0,0 +1,2 @@
+// Scripts can only read the files they are granted.
+readFile("tests/sandbox_files.gs"); // expect runtime error: Requires fs.read permission for "tests/sandbox_files.gs".
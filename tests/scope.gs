@@ -0,0 +1,21 @@
+var a = "outer";
+{
+  var a = "inner";
+  print a; // expect: inner
+}
+print a; // expect: outer
+
+fun makeCounter() {
+  var count = 0;
+  fun increment() {
+    count = count + 1;
+    return count;
+  }
+  return increment;
+}
+
+var counter = makeCounter();
+print counter(); // expect: 1.000000
+print counter(); // expect: 2.000000
+var other = makeCounter();
+print other(); // expect: 1.000000
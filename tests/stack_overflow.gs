@@ -0,0 +1,7 @@
+// Runaway recursion fails with a runtime error instead of crashing.
+fun down(n) {
+  return 1 + down(n + 1); // expect runtime error: Stack overflow.
+}
+print "before"; // expect: before
+down(0);
+print "after";
@@ -0,0 +1,4 @@
+var = 1; // expect error: Expect variable name.
+print 2
+print 3; // expect error: Expect ';' after value.
+var ok = 1;
@@ -0,0 +1,44 @@
+// Calls in tail position reuse the caller's frame, so accumulator and
+// state-machine recursion run in constant stack space.
+fun count(n, acc) {
+  if (n == 0) return acc;
+  return count(n - 1, acc + 1);
+}
+print count(100000, 0) == 100000; // expect: true
+
+fun isEven(n) {
+  if (n == 0) return true;
+  return isOdd(n - 1);
+}
+fun isOdd(n) {
+  if (n == 0) return false;
+  return isEven(n - 1);
+}
+print isEven(100001); // expect: false
+
+fun walk(state, steps) {
+  if (steps == 100000) return state;
+  match (state) {
+    "a" => return walk("b", steps + 1);
+    "b" => return walk("c", steps + 1);
+    _ => return walk("a", steps + 1);
+  }
+}
+print walk("a", 0); // expect: b
+
+// closures over a frame survive the frame being reused
+fun keep(n, first) {
+  fun get() { return n; }
+  if (first == nil) first = get;
+  if (n == 0) return first() + 10 * get();
+  return keep(n - 1, first);
+}
+print keep(3, nil) == 3; // expect: true
+
+// natives and wrong calls in tail position behave like any other call
+fun now() { return clock() > 0; }
+print now(); // expect: true
+fun wrong(n) {
+  return count(n); // expect runtime error: Expected 2 arguments but got 1.
+}
+wrong(1);
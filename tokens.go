@@ -1,6 +1,12 @@
 package main
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
 
 type TokenType int8
 
@@ -12,6 +18,8 @@ const (
 	TT_RIGHT_PAREN
 	TT_LEFT_BRACE
 	TT_RIGHT_BRACE
+	TT_LEFT_BRACKET
+	TT_RIGHT_BRACKET
 	TT_COMMA
 	TT_DOT
 	TT_MINUS
@@ -19,12 +27,17 @@ const (
 	TT_SEMICOLON
 	TT_SLASH
 	TT_STAR
+	TT_COLON
+	TT_UNDERSCORE
 
 	// One or two character tokens.
 	TT_BANG
 	TT_BANG_EQUAL
 	TT_EQUAL
 	TT_EQUAL_EQUAL
+	TT_ARROW
+	TT_DOT_DOT
+	TT_DOT_DOT_LESS
 	TT_GREATER
 	TT_GREATER_EQUAL
 	TT_LESS
@@ -43,6 +56,8 @@ const (
 	TT_FUN
 	TT_FOR
 	TT_IF
+	TT_IN
+	TT_MATCH
 	TT_NIL
 	TT_OR
 	TT_PRINT
@@ -52,6 +67,7 @@ const (
 	TT_TRUE
 	TT_VAR
 	TT_WHILE
+	TT_YIELD
 
 	// Other
 	TT_EOF
@@ -62,8 +78,141 @@ type Token struct {
 	Lexeme    string
 	Literal   interface{}
 	Line      int
+	// Column is the 1-based rune column of the first character on Line.
+	Column int
+	// Start and End are the byte offsets of the lexeme in the source.
+	Start int
+	End   int
+	// Doc holds the text of the /// doc comments directly preceding a
+	// `fun` or `var` token, one line per comment, or "" if there are none.
+	// Doc comments before any other token are dropped.
+	Doc string
+}
+
+var tokenNames = [...]string{
+	TT_NO_TOKEN:      "NO_TOKEN",
+	TT_LEFT_PAREN:    "LEFT_PAREN",
+	TT_RIGHT_PAREN:   "RIGHT_PAREN",
+	TT_LEFT_BRACE:    "LEFT_BRACE",
+	TT_RIGHT_BRACE:   "RIGHT_BRACE",
+	TT_LEFT_BRACKET:  "LEFT_BRACKET",
+	TT_RIGHT_BRACKET: "RIGHT_BRACKET",
+	TT_COMMA:         "COMMA",
+	TT_DOT:           "DOT",
+	TT_MINUS:         "MINUS",
+	TT_PLUS:          "PLUS",
+	TT_SEMICOLON:     "SEMICOLON",
+	TT_SLASH:         "SLASH",
+	TT_STAR:          "STAR",
+	TT_COLON:         "COLON",
+	TT_UNDERSCORE:    "UNDERSCORE",
+	TT_BANG:          "BANG",
+	TT_BANG_EQUAL:    "BANG_EQUAL",
+	TT_EQUAL:         "EQUAL",
+	TT_EQUAL_EQUAL:   "EQUAL_EQUAL",
+	TT_ARROW:         "ARROW",
+	TT_DOT_DOT:       "DOT_DOT",
+	TT_DOT_DOT_LESS:  "DOT_DOT_LESS",
+	TT_GREATER:       "GREATER",
+	TT_GREATER_EQUAL: "GREATER_EQUAL",
+	TT_LESS:          "LESS",
+	TT_LESS_EQUAL:    "LESS_EQUAL",
+	TT_IDENTIFIER:    "IDENTIFIER",
+	TT_STRING:        "STRING",
+	TT_NUMBER:        "NUMBER",
+	TT_AND:           "AND",
+	TT_CLASS:         "CLASS",
+	TT_ELSE:          "ELSE",
+	TT_FALSE:         "FALSE",
+	TT_FUN:           "FUN",
+	TT_FOR:           "FOR",
+	TT_IF:            "IF",
+	TT_IN:            "IN",
+	TT_MATCH:         "MATCH",
+	TT_NIL:           "NIL",
+	TT_OR:            "OR",
+	TT_PRINT:         "PRINT",
+	TT_RETURN:        "RETURN",
+	TT_SUPER:         "SUPER",
+	TT_THIS:          "THIS",
+	TT_TRUE:          "TRUE",
+	TT_VAR:           "VAR",
+	TT_WHILE:         "WHILE",
+	TT_YIELD:         "YIELD",
+	TT_EOF:           "EOF",
+}
+
+func (t TokenType) String() string {
+	if t >= 0 && int(t) < len(tokenNames) {
+		return tokenNames[t]
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
 }
 
 func (t *Token) String() string {
-	return fmt.Sprintf("%d %s %s", t.TokenType, t.Lexeme, t.Literal)
+	if t.Literal == nil {
+		return fmt.Sprintf("%s %s", t.TokenType, t.Lexeme)
+	}
+	return fmt.Sprintf("%s %s %s", t.TokenType, t.Lexeme, literalString(t.Literal))
+}
+
+// literalString writes a literal value the way it would appear in source.
+func literalString(value Any) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// tokensText lists tokens one per line as position, kind, quoted lexeme and,
+// for literals, their value.
+func tokensText(tokens []Token) string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	for _, token := range tokens {
+		fmt.Fprintf(w, "%d:%d\t%s\t%s", token.Line, token.Column, token.TokenType, strconv.Quote(token.Lexeme))
+		if token.Literal != nil {
+			fmt.Fprintf(w, "\t%s", literalString(token.Literal))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return sb.String()
+}
+
+type tokenJSON struct {
+	Kind    string `json:"kind"`
+	Lexeme  string `json:"lexeme"`
+	Literal Any    `json:"literal"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Doc     string `json:"doc,omitempty"`
+}
+
+func tokensJSON(tokens []Token) (string, error) {
+	list := make([]tokenJSON, 0, len(tokens))
+	for _, token := range tokens {
+		list = append(list, tokenJSON{
+			Kind:    token.TokenType.String(),
+			Lexeme:  token.Lexeme,
+			Literal: token.Literal,
+			Line:    token.Line,
+			Column:  token.Column,
+			Start:   token.Start,
+			End:     token.End,
+			Doc:     token.Doc,
+		})
+	}
+	bytes, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(bytes) + "\n", nil
 }
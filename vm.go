@@ -0,0 +1,581 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"runtime"
+	"slices"
+)
+
+// vmClosure is the runtime value of a compiled function declaration: the
+// function and the variables it captured.
+type vmClosure struct {
+	function *vmFunction
+	upvalues []*vmUpvalue
+	vm       *VM
+}
+
+func (c *vmClosure) Arity() int {
+	return len(c.function.params)
+}
+
+// Call runs the closure to completion on behalf of host code, such as a
+// for-in loop calling an iterator function.
+func (c *vmClosure) Call(interpreter *Interpreter, arguments []Any) Any {
+	f := c.vm.fiber
+	f.push(c)
+	for _, argument := range arguments {
+		f.push(argument)
+	}
+	depth := len(f.frames)
+	if value, ok := c.vm.call(c, len(arguments)); ok {
+		return value
+	}
+	value, _ := c.vm.run(depth)
+	return value
+}
+
+func (c *vmClosure) params() []string {
+	return c.function.params
+}
+
+func (c *vmClosure) String() string {
+	return "<fn " + c.function.name + ">"
+}
+
+// vmUpvalue is a variable captured by a closure. While the variable's scope
+// is active the upvalue refers to its slot on the stack; when the scope ends
+// the value is moved into the upvalue itself.
+type vmUpvalue struct {
+	fiber  *vmFiber
+	slot   int
+	closed Any
+	open   bool
+}
+
+func (u *vmUpvalue) get() Any {
+	if u.open {
+		return u.fiber.stack[u.slot]
+	}
+	return u.closed
+}
+
+func (u *vmUpvalue) set(value Any) {
+	if u.open {
+		u.fiber.stack[u.slot] = value
+	} else {
+		u.closed = value
+	}
+}
+
+type callFrame struct {
+	closure *vmClosure
+	ip      int
+	// base is the stack slot holding the closure, followed by its locals
+	base int
+}
+
+// vmFiber is a stack of calls. The program runs on one fiber and every
+// generator on a fiber of its own, so that a generator keeps its locals and
+// position while suspended.
+type vmFiber struct {
+	stack  []Any
+	frames []callFrame
+	// openUpvalues are the upvalues referring to the stack, ordered by slot
+	openUpvalues []*vmUpvalue
+}
+
+func (f *vmFiber) push(value Any) {
+	f.stack = append(f.stack, value)
+}
+
+func (f *vmFiber) pop() Any {
+	value := f.stack[len(f.stack)-1]
+	f.stack = f.stack[:len(f.stack)-1]
+	return value
+}
+
+func (f *vmFiber) peek(distance int) Any {
+	return f.stack[len(f.stack)-1-distance]
+}
+
+// capture returns the upvalue for a stack slot, sharing it between all the
+// closures capturing the same variable.
+func (f *vmFiber) capture(slot int) *vmUpvalue {
+	n, found := slices.BinarySearchFunc(f.openUpvalues, slot, func(u *vmUpvalue, slot int) int {
+		return u.slot - slot
+	})
+	if found {
+		return f.openUpvalues[n]
+	}
+	upvalue := &vmUpvalue{fiber: f, slot: slot, open: true}
+	f.openUpvalues = slices.Insert(f.openUpvalues, n, upvalue)
+	return upvalue
+}
+
+// closeUpvalues moves the variables in the slots from `from` up to the heap.
+func (f *vmFiber) closeUpvalues(from int) {
+	n := len(f.openUpvalues)
+	for n > 0 && f.openUpvalues[n-1].slot >= from {
+		upvalue := f.openUpvalues[n-1]
+		upvalue.closed = f.stack[upvalue.slot]
+		upvalue.open = false
+		n--
+	}
+	f.openUpvalues = f.openUpvalues[:n]
+}
+
+// vmGenerator is the value returned by calling a compiled generator. It runs
+// its body on its own fiber up to the next yield whenever it is resumed.
+type vmGenerator struct {
+	name    string
+	fiber   *vmFiber
+	vm      *VM
+	running bool
+	done    bool
+}
+
+func (g *vmGenerator) Arity() int {
+	return 0
+}
+
+func (g *vmGenerator) Call(interpreter *Interpreter, arguments []Any) Any {
+	value, _ := g.next()
+	return value
+}
+
+func (g *vmGenerator) next() (Any, bool) {
+	if g.done {
+		return nil, false
+	}
+	if g.running {
+		panic(nativeError("Generator is already running."))
+	}
+	g.running = true
+	saved := g.vm.fiber
+	defer func() {
+		g.vm.fiber = saved
+		g.running = false
+		if err := recover(); err != nil {
+			g.done = true
+			panic(err)
+		}
+	}()
+	g.vm.fiber = g.fiber
+	value, yielded := g.vm.run(0)
+	if !yielded {
+		g.done = true
+		return nil, false
+	}
+	return value, true
+}
+
+func (g *vmGenerator) String() string {
+	return "<generator " + g.name + ">"
+}
+
+// vmIterator is the state of a for-in loop. Lists and ranges, the common
+// case, are stepped through directly; everything else goes through the
+// iterator protocol of the tree-walker.
+type vmIterator struct {
+	pairs    bool
+	elements []Any
+	numbers  *Range
+	next     func() (Any, Any, bool)
+	n        int
+}
+
+func (it *vmIterator) advance() (Any, Any, bool) {
+	switch {
+	case it.elements != nil:
+		if it.n >= len(it.elements) {
+			return nil, nil, false
+		}
+		it.n++
+		return float64(it.n - 1), it.elements[it.n-1], true
+	case it.numbers != nil:
+		x := it.numbers.Start + float64(it.n)
+		if !it.numbers.contains(x) {
+			return nil, nil, false
+		}
+		it.n++
+		return float64(it.n - 1), x, true
+	}
+	return it.next()
+}
+
+// VM runs compiled programs. It shares the globals and native functions of
+// the interpreter it was created for.
+type VM struct {
+	interpreter *Interpreter
+	globals     map[string]Any
+	// fiber is the fiber currently running
+	fiber *vmFiber
+}
+
+func NewVM(interpreter *Interpreter) *VM {
+	return &VM{interpreter: interpreter, globals: interpreter.globals.values, fiber: &vmFiber{}}
+}
+
+// Interpret runs a compiled program, reporting and returning runtime errors
+// like Interpreter.Interpret.
+func (vm *VM) Interpret(script *vmFunction) error {
+	return vm.InterpretContext(context.Background(), script)
+}
+
+// InterpretContext runs a compiled program until ctx is done, like
+// Interpreter.InterpretContext.
+func (vm *VM) InterpretContext(ctx context.Context, script *vmFunction) (err error) {
+	defer vm.interpreter.withContext(ctx)()
+	defer vm.interpreter.recoverFault(&err)
+	vm.fiber = &vmFiber{}
+	closure := &vmClosure{function: script, vm: vm}
+	vm.fiber.push(closure)
+	vm.call(closure, 0)
+	vm.run(0)
+	return nil
+}
+
+// call calls the value below argc arguments on the stack. Compiled
+// functions get a new frame for run to execute; other callables run at
+// once, and call returns their result and true.
+func (vm *VM) call(callee Any, argc int) (Any, bool) {
+	f := vm.fiber
+	function, ok := callee.(Callable)
+	if !ok {
+		panic(nativeError("Can only call functions."))
+	}
+	if argc != function.Arity() {
+		panic(nativeError(fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), argc)))
+	}
+	base := len(f.stack) - argc - 1
+	closure, ok := callee.(*vmClosure)
+	if !ok {
+		arguments := slices.Clone(f.stack[base+1:])
+		f.stack = f.stack[:base]
+		return vm.interpreter.invoke(function, arguments), true
+	}
+	if closure.function.generator {
+		fiber := &vmFiber{stack: slices.Clone(f.stack[base:])}
+		fiber.frames = []callFrame{{closure: closure}}
+		f.stack = f.stack[:base]
+		g := &vmGenerator{name: closure.function.name, fiber: fiber, vm: vm}
+		return g, true
+	}
+	// the bottom frame runs the script, or a generator's body
+	if len(f.frames) > vm.interpreter.MaxDepth {
+		panic(vm.stackOverflow())
+	}
+	f.frames = append(f.frames, callFrame{closure: closure, base: base})
+	return nil, false
+}
+
+// stackOverflow returns the error for a call that would exceed MaxDepth,
+// tracing the frames of the running fiber.
+func (vm *VM) stackOverflow() RuntimeError {
+	f := vm.fiber
+	trace := make([]string, 0, len(f.frames))
+	for n := len(f.frames) - 1; n >= 0; n-- {
+		frame := f.frames[n]
+		line := frame.closure.function.chunk.tokens[frame.ip-1].Line
+		if n == 0 && frame.closure.function.name == "script" {
+			trace = append(trace, fmt.Sprintf("[line %d] in script", line))
+		} else {
+			trace = append(trace, fmt.Sprintf("[line %d] in %s()", line, frame.closure.function.name))
+		}
+	}
+	top := f.frames[len(f.frames)-1]
+	paren := top.closure.function.chunk.tokens[top.ip-1]
+	return RuntimeError{token: paren, message: "Stack overflow.", trace: foldRepeats(trace)}
+}
+
+// run executes the current fiber until the frame at depth returns, or its
+// bottom frame yields. It returns the value returned or yielded, and
+// whether the fiber yielded.
+func (vm *VM) run(depth int) (Any, bool) {
+	f := vm.fiber
+	frame := &f.frames[len(f.frames)-1]
+	chunk := frame.closure.function.chunk
+	code := chunk.code
+	ip := frame.ip
+	at := ip
+
+	// runtime errors are reported at the token of the failing instruction
+	defer func() {
+		if err := recover(); err != nil {
+			panic(atCall(err, chunk.tokens[at]))
+		}
+	}()
+
+	readShort := func() int {
+		ip += 2
+		return int(code[ip-2])<<8 | int(code[ip-1])
+	}
+	fail := func(message string) {
+		panic(nativeError(message))
+	}
+	numbers := func() (float64, float64) {
+		left, lok := f.peek(1).(float64)
+		right, rok := f.peek(0).(float64)
+		if !lok || !rok {
+			fail("Operands must be a numbers.")
+		}
+		f.stack = f.stack[:len(f.stack)-2]
+		return left, right
+	}
+
+	for {
+		at = ip
+		op := OpCode(code[ip])
+		ip++
+		switch op {
+		case OP_CONSTANT:
+			f.push(chunk.constants[readShort()])
+		case OP_NIL:
+			f.push(nil)
+		case OP_TRUE:
+			f.push(true)
+		case OP_FALSE:
+			f.push(false)
+		case OP_POP:
+			f.stack = f.stack[:len(f.stack)-1]
+		case OP_GET_LOCAL:
+			f.push(f.stack[frame.base+int(code[ip])])
+			ip++
+		case OP_SET_LOCAL:
+			f.stack[frame.base+int(code[ip])] = f.peek(0)
+			ip++
+		case OP_GET_GLOBAL:
+			name := chunk.constants[readShort()].(string)
+			value, ok := vm.globals[name]
+			if !ok {
+				fail("Undefined variable '" + name + "'.")
+			}
+			f.push(value)
+		case OP_DEFINE_GLOBAL:
+			vm.globals[chunk.constants[readShort()].(string)] = f.pop()
+		case OP_SET_GLOBAL:
+			name := chunk.constants[readShort()].(string)
+			if _, ok := vm.globals[name]; !ok {
+				fail("Undefined variable '" + name + "'.")
+			}
+			vm.globals[name] = f.peek(0)
+		case OP_GET_UPVALUE:
+			f.push(frame.closure.upvalues[code[ip]].get())
+			ip++
+		case OP_SET_UPVALUE:
+			frame.closure.upvalues[code[ip]].set(f.peek(0))
+			ip++
+		case OP_EQUAL:
+			right := f.pop()
+			f.stack[len(f.stack)-1] = vm.interpreter.isEqual(f.peek(0), right)
+		case OP_NOT_EQUAL:
+			right := f.pop()
+			f.stack[len(f.stack)-1] = !vm.interpreter.isEqual(f.peek(0), right)
+		case OP_GREATER:
+			left, right := numbers()
+			f.push(left > right)
+		case OP_GREATER_EQUAL:
+			left, right := numbers()
+			f.push(left >= right)
+		case OP_LESS:
+			left, right := numbers()
+			f.push(left < right)
+		case OP_LESS_EQUAL:
+			left, right := numbers()
+			f.push(left <= right)
+		case OP_ADD:
+			switch left := f.peek(1).(type) {
+			case float64:
+				if right, ok := f.peek(0).(float64); ok {
+					f.pop()
+					f.stack[len(f.stack)-1] = left + right
+					continue
+				}
+			case string:
+				if right, ok := f.peek(0).(string); ok {
+					vm.interpreter.allocate(chunk.tokens[at], len(left)+len(right))
+					f.pop()
+					f.stack[len(f.stack)-1] = left + right
+					continue
+				}
+			}
+			fail("Operands must be a numbers or strings.")
+		case OP_SUBTRACT:
+			left, right := numbers()
+			f.push(left - right)
+		case OP_MULTIPLY:
+			left, right := numbers()
+			f.push(left * right)
+		case OP_DIVIDE:
+			left, right := numbers()
+			f.push(left / right)
+		case OP_NOT:
+			f.stack[len(f.stack)-1] = !vm.interpreter.isTruthy(f.peek(0))
+		case OP_NEGATE:
+			n, ok := f.peek(0).(float64)
+			if !ok {
+				fail("Operand must be a number.")
+			}
+			f.stack[len(f.stack)-1] = -n
+		case OP_RANGE:
+			start, end := numbers()
+			f.push(&Range{Start: start, End: end, Inclusive: code[ip] == 1})
+			ip++
+		case OP_KEY:
+			if !isHashable(f.peek(0)) {
+				fail("Map key must be a number, string or boolean.")
+			}
+		case OP_LIST:
+			n := readShort()
+			vm.interpreter.allocate(chunk.tokens[at], n*ELEMENT_SIZE)
+			elements := slices.Clone(f.stack[len(f.stack)-n:])
+			f.stack = f.stack[:len(f.stack)-n]
+			f.push(NewList(elements))
+		case OP_MAP:
+			n := readShort()
+			vm.interpreter.allocate(chunk.tokens[at], n*ENTRY_SIZE)
+			dict := NewMap()
+			entries := f.stack[len(f.stack)-2*n:]
+			for k := 0; k < len(entries); k += 2 {
+				dict.Set(entries[k], entries[k+1])
+			}
+			f.stack = f.stack[:len(f.stack)-2*n]
+			f.push(dict)
+		case OP_PRINT:
+			fmt.Fprintf(stdout, "%s\n", vm.interpreter.stringify(f.pop()))
+		case OP_JUMP:
+			offset := readShort()
+			ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := readShort()
+			if !vm.interpreter.isTruthy(f.pop()) {
+				ip += offset
+			}
+		case OP_LOOP:
+			vm.interpreter.step(chunk.tokens[at])
+			offset := readShort()
+			ip -= offset
+		case OP_CALL, OP_TAIL_CALL:
+			vm.interpreter.step(chunk.tokens[at])
+			argc := int(code[ip])
+			ip++
+			frame.ip = ip
+			if closure, ok := f.peek(argc).(*vmClosure); ok && op == OP_TAIL_CALL &&
+				!closure.function.generator && len(closure.function.params) == argc {
+				// the callee and its arguments take the place of the frame
+				f.closeUpvalues(frame.base)
+				f.stack = append(f.stack[:frame.base], f.stack[len(f.stack)-argc-1:]...)
+				frame.closure = closure
+				chunk = closure.function.chunk
+				code = chunk.code
+				ip = 0
+				continue
+			}
+			value, done := vm.call(f.peek(argc), argc)
+			// host code may have run closures, moving the frames
+			frame = &f.frames[len(f.frames)-1]
+			if done {
+				f.push(value)
+				continue
+			}
+			chunk = frame.closure.function.chunk
+			code = chunk.code
+			ip = 0
+		case OP_CLOSURE:
+			function := chunk.constants[readShort()].(*vmFunction)
+			closure := &vmClosure{function: function, upvalues: make([]*vmUpvalue, function.upvalueCount), vm: vm}
+			for n := range closure.upvalues {
+				isLocal, index := code[ip], int(code[ip+1])
+				ip += 2
+				if isLocal == 1 {
+					closure.upvalues[n] = f.capture(frame.base + index)
+				} else {
+					closure.upvalues[n] = frame.closure.upvalues[index]
+				}
+			}
+			f.push(closure)
+		case OP_CLOSE_UPVALUE:
+			f.closeUpvalues(len(f.stack) - 1)
+			f.pop()
+		case OP_RETURN:
+			result := f.pop()
+			f.closeUpvalues(frame.base)
+			f.stack = f.stack[:frame.base]
+			f.frames = f.frames[:len(f.frames)-1]
+			if len(f.frames) == depth {
+				return result, false
+			}
+			f.push(result)
+			frame = &f.frames[len(f.frames)-1]
+			chunk = frame.closure.function.chunk
+			code = chunk.code
+			ip = frame.ip
+		case OP_ITERATE:
+			f.stack[len(f.stack)-1] = vm.iterator(chunk.tokens[at], f.peek(0), code[ip] == 1)
+			ip++
+		case OP_NEXT:
+			it := f.stack[frame.base+int(code[ip])].(*vmIterator)
+			ip++
+			offset := readShort()
+			// the iterator may call back into compiled code
+			frame.ip = ip
+			key, value, ok := it.advance()
+			frame = &f.frames[len(f.frames)-1]
+			if !ok {
+				ip += offset
+			} else if it.pairs {
+				f.push(key)
+				f.push(value)
+			} else {
+				f.push(value)
+			}
+		case OP_MATCH:
+			subject := f.stack[frame.base+int(code[ip])]
+			ip++
+			arm := chunk.constants[readShort()].(vmArm)
+			f.push(vm.match(arm, subject, frame.base))
+		case OP_YIELD:
+			frame.ip = ip
+			return f.pop(), true
+		case OP_FAIL:
+			fail(chunk.constants[readShort()].(string))
+		}
+	}
+}
+
+// iterator starts a for-in loop over subject.
+func (vm *VM) iterator(token Token, subject Any, pairs bool) *vmIterator {
+	it := &vmIterator{pairs: pairs}
+	switch v := subject.(type) {
+	case *List:
+		it.elements = v.Elements
+		if it.elements == nil {
+			it.elements = []Any{}
+		}
+	case *Range:
+		it.numbers = v
+	default:
+		next, stop := iter.Pull2(vm.interpreter.iterate(token, subject, pairs))
+		it.next = next
+		// a loop left early by a return never finishes the sequence
+		runtime.AddCleanup(it, func(stop func()) { stop() }, stop)
+	}
+	return it
+}
+
+// match tests subject against the patterns of an arm, storing the values it
+// binds in the frame starting at base.
+func (vm *VM) match(arm vmArm, subject Any, base int) bool {
+	f := vm.fiber
+	matcher := &patternMatcher{interpreter: vm.interpreter, bind: func(name Token, value Any) {
+		f.stack[base+arm.slots[name.Lexeme]] = value
+	}}
+	for _, pattern := range arm.patterns {
+		if matcher.match(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+const fibScript = `
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 1) + fib(n - 2);
+}
+print fib(20);
+`
+
+const loopScript = `
+var sum = 0;
+var i = 0;
+while (i < 100000) {
+  sum = sum + i;
+  i = i + 1;
+}
+for (n in 0..<100000) {
+  sum = sum - n;
+}
+print sum;
+`
+
+// benchmarkScript runs source with each engine, parsing and compiling it
+// once outside of the timed loop.
+func benchmarkScript(b *testing.B, source string) {
+	newSession(b)
+	stdout = io.Discard
+	stmts := compile("bench.gs", source)
+	if stmts == nil {
+		b.Fatal("script has errors")
+	}
+
+	b.Run("tree", func(b *testing.B) {
+		for b.Loop() {
+			interpreter.Interpret(stmts)
+		}
+	})
+	b.Run("vm", func(b *testing.B) {
+		script := NewCompiler().Compile(stmts)
+		vm := NewVM(interpreter)
+		for b.Loop() {
+			vm.Interpret(script)
+		}
+	})
+	if hadRuntimeError {
+		b.Fatal("script failed")
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	benchmarkScript(b, fibScript)
+}
+
+func BenchmarkLoop(b *testing.B) {
+	benchmarkScript(b, loopScript)
+}
+
+func TestVM_SharesGlobals(t *testing.T) {
+	newSession(t)
+	NewVM(interpreter).Interpret(NewCompiler().Compile(compile("a.gs", "var a = 1; fun f() { return a + 1; }")))
+	interpreter.Interpret(compile("b.gs", "var b = f();"))
+	if interpreter.globals.values["b"] != 2.0 {
+		t.Errorf("b = %v, want 2", interpreter.globals.values["b"])
+	}
+}
+
+// An iterator function that loops over itself overflows the stack of the
+// fiber the loop runs on.
+func TestVM_IteratorStackOverflow(t *testing.T) {
+	source := "fun it() {\n  for (x in it) {}\n  return nil;\n}\nfor (x in it) {}"
+	err := interpretWith(t, ENGINE_VM, source, func(i *Interpreter) { i.MaxDepth = 10 })
+	var runtimeErr RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.message != "Stack overflow." || runtimeErr.token.Line != 2 {
+		t.Errorf("got %v, want Stack overflow. on line 2", err)
+	}
+}